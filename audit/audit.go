@@ -0,0 +1,148 @@
+/*
+权限变更审计：每次授权、回收、新建用户等修改ccd文件的操作记录一条审计记录;
+记录只追加不修改，存储为 JSONL 文件或 redis stream，可按用户或目标IP查询历史;
+*/
+package audit
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// 审计记录的操作 工单操作 grant/revoke/replace 与 schema 中的一致
+const (
+	ActionCreate     = "create"     // 新建ccd文件并分配VIP
+	ActionExpire     = "expire"     // 回收过期的限时路由
+	ActionDisable    = "disable"    // AD账户禁用或过期 写入 disable
+	ActionEnable     = "enable"     // AD账户恢复 移除 disable
+	ActionQuarantine = "quarantine" // 没有ldap用户的ccd文件移入隔离目录
+	ActionDelete     = "delete"     // 删除ccd文件并回收VIP
+)
+
+// Record 一次权限变更
+type Record struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Source   string    `json:"source"`           // 变更来源 mq/admin/cli/expire/account-sync/scan
+	MsgId    string    `json:"msgId,omitempty"`  // 工单消息Id
+	SpName   string    `json:"spName,omitempty"` // 工单名
+	Userid   string    `json:"userid,omitempty"` // 工单中的用户id(审批人)
+	Instance string    `json:"instance"`
+	Sam      string    `json:"sam"`
+	Vip      string    `json:"vip,omitempty"`
+	Before   []string  `json:"before"` // 变更前的路由 network netmask
+	After    []string  `json:"after"`  // 变更后的路由
+	Detail   string    `json:"detail,omitempty"`
+}
+
+// Diff 变更前后新增与删除的路由
+func (r *Record) Diff() (added, removed []string) {
+	before, after := map[string]bool{}, map[string]bool{}
+	for _, route := range r.Before {
+		before[route] = true
+	}
+	for _, route := range r.After {
+		after[route] = true
+		if !before[route] {
+			added = append(added, route)
+		}
+	}
+	for _, route := range r.Before {
+		if !after[route] {
+			removed = append(removed, route)
+		}
+	}
+	return
+}
+
+// Filter 查询条件 零值的条件不限制
+type Filter struct {
+	Instance string
+	Sam      string
+	Dest     string // 目标IP或CIDR 匹配变更前或变更后包含该地址的路由
+	Since    time.Time
+	Until    time.Time
+	Limit    int // 只返回最近的 Limit 条
+}
+
+// Validate 校验查询条件
+func (f *Filter) Validate() error {
+	if f.Dest == "" {
+		return nil
+	}
+	_, err := parseDest(f.Dest)
+	return err
+}
+
+// Match 记录是否满足查询条件
+func (f *Filter) Match(r *Record) bool {
+	if f.Instance != "" && r.Instance != f.Instance {
+		return false
+	}
+	if f.Sam != "" && r.Sam != f.Sam {
+		return false
+	}
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && r.Time.After(f.Until) {
+		return false
+	}
+	if f.Dest == "" {
+		return true
+	}
+	dest, err := parseDest(f.Dest)
+	if err != nil {
+		return false
+	}
+	for _, routes := range [][]string{r.Before, r.After} {
+		for _, route := range routes {
+			if n := parseRoute(route); n != nil && (n.Contains(dest.IP) || dest.Contains(n.IP)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// limit 保留最近的 n 条 n 为0时不限制
+func limit(records []*Record, n int) []*Record {
+	if n > 0 && len(records) > n {
+		return records[len(records)-n:]
+	}
+	return records
+}
+
+// parseDest 解析目标IP或CIDR
+func parseDest(dest string) (*net.IPNet, error) {
+	if !strings.Contains(dest, "/") {
+		dest += "/32"
+	}
+	_, n, err := net.ParseCIDR(dest)
+	if err != nil || n.IP.To4() == nil {
+		return nil, fmt.Errorf("不是合法的IPv4地址或CIDR: %s", dest)
+	}
+	return n, nil
+}
+
+// parseRoute 解析 network netmask 形式的路由
+func parseRoute(route string) *net.IPNet {
+	fields := strings.Fields(route)
+	if len(fields) != 2 {
+		return nil
+	}
+	ip, mask := net.ParseIP(fields[0]).To4(), net.ParseIP(fields[1]).To4()
+	if ip == nil || mask == nil {
+		return nil
+	}
+	return &net.IPNet{IP: ip.Mask(net.IPMask(mask)), Mask: net.IPMask(mask)}
+}
+
+// Store 审计记录的存储 只追加
+type Store interface {
+	Append(r *Record) error
+	// Query 按时间顺序返回满足条件的记录
+	Query(f *Filter) ([]*Record, error)
+}
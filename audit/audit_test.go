@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"mq/cache"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var records = []*Record{
+	{Time: time.Unix(1641200400, 0), Action: ActionCreate, Source: "mq", Instance: "default", Sam: "zhangsan", Vip: "10.11.0.2",
+		After: []string{"10.0.0.53 255.255.255.255"}},
+	{Time: time.Unix(1641200401, 0), Action: "grant", Source: "mq", MsgId: "1", SpName: "SP-1", Userid: "1001", Instance: "default", Sam: "zhangsan",
+		Vip: "10.11.0.2", Before: []string{"10.0.0.53 255.255.255.255"}, After: []string{"10.0.0.53 255.255.255.255", "10.16.3.0 255.255.255.0"}},
+	{Time: time.Unix(1641200402, 0), Action: "grant", Source: "cli", Instance: "default", Sam: "lisi", Vip: "10.11.0.3",
+		After: []string{"192.168.5.9 255.255.255.255"}},
+	{Time: time.Unix(1641200403, 0), Action: "revoke", Source: "admin", Instance: "default", Sam: "zhangsan", Vip: "10.11.0.2",
+		Before: []string{"10.0.0.53 255.255.255.255", "10.16.3.0 255.255.255.0"}, After: []string{"10.0.0.53 255.255.255.255"}},
+}
+
+func testStore(t *testing.T, s Store) {
+	for _, r := range records {
+		if err := s.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		filter *Filter
+		want   []int // records 的下标
+	}{
+		{&Filter{}, []int{0, 1, 2, 3}},
+		{&Filter{Sam: "zhangsan"}, []int{0, 1, 3}},
+		{&Filter{Sam: "zhangsan", Limit: 2}, []int{1, 3}},
+		{&Filter{Dest: "10.16.3.7"}, []int{1, 3}},
+		{&Filter{Dest: "192.168.0.0/16"}, []int{2}},
+		{&Filter{Instance: "udp"}, nil},
+		{&Filter{Since: time.Unix(1641200402, 0)}, []int{2, 3}},
+	}
+	for _, c := range cases {
+		got, err := s.Query(c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("Query(%+v) = %d records, want %d", c.filter, len(got), len(c.want))
+			continue
+		}
+		for i, idx := range c.want {
+			if got[i].Sam != records[idx].Sam || !got[i].Time.Equal(records[idx].Time) || got[i].Action != records[idx].Action {
+				t.Errorf("Query(%+v)[%d] = %+v, want %+v", c.filter, i, got[i], records[idx])
+			}
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	s := NewFileStore(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if got, err := s.Query(&Filter{}); err != nil || len(got) != 0 {
+		t.Fatalf("文件不存在时应返回空列表: %v, %v", got, err)
+	}
+	testStore(t, s)
+}
+
+func TestRedisStore(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	if err = cache.Init(&cache.Config{Addr: mr.Addr()}); err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, NewRedisStore(""))
+}
+
+func TestDiff(t *testing.T) {
+	added, removed := records[1].Diff()
+	if len(added) != 1 || added[0] != "10.16.3.0 255.255.255.0" || len(removed) != 0 {
+		t.Errorf("added = %v removed = %v", added, removed)
+	}
+	if err := (&Filter{Dest: "10.16.3"}).Validate(); err == nil {
+		t.Error("不合法的目标地址应返回错误")
+	}
+}
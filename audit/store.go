@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"mq/cache"
+	"os"
+	"sync"
+)
+
+const (
+	DefaultPath = "uvpn-audit.jsonl" // 默认审计文件
+	DefaultKey  = "OVPNAUDIT"        // 默认审计 redis stream 键
+
+	maxLineSize = 4 << 20 // 单条记录最大长度
+)
+
+// FileStore 审计记录逐行追加到 JSONL 文件
+// 每次追加时以 O_APPEND 打开文件并一次写入整行 多个进程同时追加也不会交错 文件可以被外部轮转
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStore 新建文件存储 path 为空时为 uvpn-audit.jsonl
+func NewFileStore(path string) *FileStore {
+	if path == "" {
+		path = DefaultPath
+	}
+	return &FileStore{path: path}
+}
+
+// Append 追加一条记录
+func (s *FileStore) Append(r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return errors.Wrap(err, "Fail to open audit file")
+	}
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return errors.Wrap(err, "Fail to append audit record")
+	}
+	return f.Close()
+}
+
+// Query 顺序扫描文件 文件不存在时返回空列表
+func (s *FileStore) Query(filter *Filter) (records []*Record, err error) {
+	records = []*Record{}
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		r := &Record{}
+		if err = json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return nil, fmt.Errorf("审计文件第%d行: %v", lineNo, err)
+		}
+		if filter.Match(r) {
+			records = append(records, r)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return limit(records, filter.Limit), nil
+}
+
+// RedisStore 审计记录追加到 redis stream 每条消息的 record 字段为记录的json
+type RedisStore struct {
+	key string
+}
+
+// NewRedisStore 新建 redis stream 存储 key 为空时为 OVPNAUDIT
+func NewRedisStore(key string) *RedisStore {
+	if key == "" {
+		key = DefaultKey
+	}
+	return &RedisStore{key: key}
+}
+
+// Append 追加一条记录
+func (s *RedisStore) Append(r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = cache.XAdd(s.key, map[string]interface{}{"record": string(data)})
+	return err
+}
+
+// Query 读取整个 stream 后过滤
+func (s *RedisStore) Query(filter *Filter) (records []*Record, err error) {
+	records = []*Record{}
+	messages, err := cache.XRange(s.key, "-", "+")
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range messages {
+		data, _ := msg.Values["record"].(string)
+		r := &Record{}
+		if err = json.Unmarshal([]byte(data), r); err != nil {
+			return nil, fmt.Errorf("审计记录[%s]: %v", msg.ID, err)
+		}
+		if filter.Match(r) {
+			records = append(records, r)
+		}
+	}
+	return limit(records, filter.Limit), nil
+}
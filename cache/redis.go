@@ -4,14 +4,37 @@ import (
 	"context"
 	"errors"
 	"github.com/go-redis/redis/v8"
+	"strconv"
 	"time"
 )
 
 var (
 	RedisClient *redis.Client
 	ctx         = context.Background() // 最新版本的redis需要传上下文参数
+
+	ErrSeqExhausted = errors.New("Sequence exhausted")
 )
 
+// fetchAndIncrScript 取出序列当前值并加1 键不存在时从ARGV[1]开始 当前值超过ARGV[2]时返回-1
+var fetchAndIncrScript = redis.NewScript(`
+local cur = tonumber(redis.call('GET', KEYS[1]) or ARGV[1])
+if cur > tonumber(ARGV[2]) then
+	return -1
+end
+redis.call('SET', KEYS[1], cur + 1)
+return cur
+`)
+
+// setMaxScript 键的值小于ARGV[1]或不存在时设为ARGV[1] 返回设置后的值
+var setMaxScript = redis.NewScript(`
+local cur = tonumber(redis.call('GET', KEYS[1]) or ARGV[1])
+if cur < tonumber(ARGV[1]) then
+	cur = tonumber(ARGV[1])
+end
+redis.call('SET', KEYS[1], cur)
+return cur
+`)
+
 // Config redis 配置
 type Config struct {
 	Addr         string
@@ -61,6 +84,18 @@ func Get(key string) (string, error) {
 	return RedisClient.Get(ctx, key).Result()
 }
 
+// Del 删除缓存项
+func Del(keys ...string) (err error) {
+	if len(keys) == 0 {
+		return
+	}
+	err = RedisClient.Del(ctx, keys...).Err()
+	if err != nil {
+		err = errors.New("Fail to delete keys, err: " + err.Error())
+	}
+	return
+}
+
 // Exists 判断缓存项是否存在
 func Exists(key string) (res bool, err error) {
 	result, err := RedisClient.Exists(ctx, key).Result()
@@ -74,3 +109,157 @@ func Exists(key string) (res bool, err error) {
 		return false, nil
 	}
 }
+
+// ZAdd 向有序集合写入成员 已存在则更新分数
+func ZAdd(key string, score float64, member string) (err error) {
+	err = RedisClient.ZAdd(ctx, key, &redis.Z{Score: score, Member: member}).Err()
+	if err != nil {
+		err = errors.New("Fail to add sorted set member, err: " + err.Error())
+	}
+	return
+}
+
+// ZRem 从有序集合删除成员
+func ZRem(key string, members ...string) (err error) {
+	if len(members) == 0 {
+		return
+	}
+	args := make([]interface{}, 0, len(members))
+	for _, member := range members {
+		args = append(args, member)
+	}
+	err = RedisClient.ZRem(ctx, key, args...).Err()
+	if err != nil {
+		err = errors.New("Fail to remove sorted set member, err: " + err.Error())
+	}
+	return
+}
+
+// ZScore 取有序集合成员的分数 成员不存在时 exists 为 false
+func ZScore(key, member string) (score float64, exists bool, err error) {
+	score, err = RedisClient.ZScore(ctx, key, member).Result()
+	if err == redis.Nil {
+		return 0, false, nil
+	}
+	return score, err == nil, err
+}
+
+// ZRangeByScore 取有序集合中分数在[min, max]内的成员
+func ZRangeByScore(key string, min, max float64) ([]string, error) {
+	return RedisClient.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: strconv.FormatFloat(min, 'f', -1, 64),
+		Max: strconv.FormatFloat(max, 'f', -1, 64),
+	}).Result()
+}
+
+// FetchAndIncr 原子地取出序列当前值并加1 多个进程共用同一redis时也不会取到重复值
+// 键不存在时从 init 开始; 当前值超过 max 时返回 ErrSeqExhausted
+func FetchAndIncr(key string, init, max int64) (int64, error) {
+	cur, err := fetchAndIncrScript.Run(ctx, RedisClient, []string{key}, init, max).Int64()
+	if err != nil {
+		return 0, errors.New("Fail to fetch and increase sequence, err: " + err.Error())
+	}
+	if cur < 0 {
+		return 0, ErrSeqExhausted
+	}
+	return cur, nil
+}
+
+// SetMax 原子地将序列提高到不小于 value 返回提高后的值
+func SetMax(key string, value int64) (int64, error) {
+	cur, err := setMaxScript.Run(ctx, RedisClient, []string{key}, value).Int64()
+	if err != nil {
+		return 0, errors.New("Fail to raise sequence, err: " + err.Error())
+	}
+	return cur, nil
+}
+
+// SAdd 向集合写入成员
+func SAdd(key string, members ...string) (err error) {
+	if len(members) == 0 {
+		return
+	}
+	args := make([]interface{}, 0, len(members))
+	for _, member := range members {
+		args = append(args, member)
+	}
+	err = RedisClient.SAdd(ctx, key, args...).Err()
+	if err != nil {
+		err = errors.New("Fail to add set member, err: " + err.Error())
+	}
+	return
+}
+
+// SRem 从集合删除成员
+func SRem(key string, member string) (err error) {
+	err = RedisClient.SRem(ctx, key, member).Err()
+	if err != nil {
+		err = errors.New("Fail to remove set member, err: " + err.Error())
+	}
+	return
+}
+
+// SIsMember 是否为集合成员
+func SIsMember(key string, member string) (bool, error) {
+	return RedisClient.SIsMember(ctx, key, member).Result()
+}
+
+// SMembers 集合的全部成员
+func SMembers(key string) ([]string, error) {
+	return RedisClient.SMembers(ctx, key).Result()
+}
+
+// SPop 随机弹出集合中的一个成员 集合为空时返回空字符串
+func SPop(key string) (string, error) {
+	member, err := RedisClient.SPop(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return member, err
+}
+
+// HSet 写入哈希表字段
+func HSet(key, field, value string) (err error) {
+	err = RedisClient.HSet(ctx, key, field, value).Err()
+	if err != nil {
+		err = errors.New("Fail to set hash field, err: " + err.Error())
+	}
+	return
+}
+
+// HGet 取哈希表字段 字段不存在时返回空字符串
+func HGet(key, field string) (string, error) {
+	value, err := RedisClient.HGet(ctx, key, field).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+// HGetAll 取哈希表的全部字段
+func HGetAll(key string) (map[string]string, error) {
+	return RedisClient.HGetAll(ctx, key).Result()
+}
+
+// HDel 删除哈希表字段
+func HDel(key, field string) (err error) {
+	err = RedisClient.HDel(ctx, key, field).Err()
+	if err != nil {
+		err = errors.New("Fail to delete hash field, err: " + err.Error())
+	}
+	return
+}
+
+// XAdd 追加消息到 stream 返回消息Id
+func XAdd(key string, values map[string]interface{}) (string, error) {
+	id, err := RedisClient.XAdd(ctx, &redis.XAddArgs{Stream: key, Values: values}).Result()
+	if err != nil {
+		err = errors.New("Fail to append stream, err: " + err.Error())
+	}
+	return id, err
+}
+
+// XRange 读取 stream 中消息Id在 start 与 stop 之间的消息 - 与 + 表示最早与最新
+func XRange(key, start, stop string) ([]redis.XMessage, error) {
+	return RedisClient.XRange(ctx, key, start, stop).Result()
+}
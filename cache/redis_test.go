@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"testing"
+)
+
+func setupRedis(t *testing.T) *miniredis.Miniredis {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	if err = Init(&Config{Addr: mr.Addr()}); err != nil {
+		t.Fatal(err)
+	}
+	return mr
+}
+
+// 键不存在时从 init 开始依次加1 超过 max 后返回 ErrSeqExhausted 且不再增加
+func TestFetchAndIncr(t *testing.T) {
+	mr := setupRedis(t)
+	for want := int64(2); want <= 4; want++ {
+		cur, err := FetchAndIncr("SEQ", 2, 4)
+		if err != nil || cur != want {
+			t.Fatalf("FetchAndIncr = %d, %v, want %d", cur, err, want)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := FetchAndIncr("SEQ", 2, 4); err != ErrSeqExhausted {
+			t.Fatalf("FetchAndIncr after max: %v", err)
+		}
+	}
+	if v, _ := mr.Get("SEQ"); v != "5" {
+		t.Errorf("SEQ = %s, want 5", v)
+	}
+
+	// 值不是数字时返回错误
+	mr.Set("BAD", "x")
+	if _, err := FetchAndIncr("BAD", 2, 4); err == nil || err == ErrSeqExhausted {
+		t.Errorf("FetchAndIncr on non-number: %v", err)
+	}
+}
+
+// 只会提高序列的值
+func TestSetMax(t *testing.T) {
+	setupRedis(t)
+	for _, c := range []struct{ value, want int64 }{{5, 5}, {3, 5}, {9, 9}} {
+		if cur, err := SetMax("SEQ", c.value); err != nil || cur != c.want {
+			t.Errorf("SetMax(%d) = %d, %v, want %d", c.value, cur, err, c.want)
+		}
+	}
+	if cur, err := FetchAndIncr("SEQ", 2, 100); err != nil || cur != 9 {
+		t.Errorf("FetchAndIncr after SetMax = %d, %v", cur, err)
+	}
+}
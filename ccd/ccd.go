@@ -0,0 +1,564 @@
+/*
+OpenVPN client-config-dir(ccd) 文件的结构化表示：
+支持解析 ifconfig-push、push "route ..."、iroute、push "dhcp-option ..."、disable、注释等指令;
+未修改的行按原文输出，保证 解析->渲染 无损往返;
+*/
+package ccd
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Kind 行类型
+type Kind int
+
+const (
+	Blank          Kind = iota // 空行
+	Comment                    // 注释 以 # 或 ; 开头
+	IfconfigPush               // ifconfig-push local remote-netmask
+	PushRoute                  // push "route network [netmask] [gateway] [metric]"
+	Iroute                     // iroute network [netmask]
+	PushDhcpOption             // push "dhcp-option type [value]"
+	Push                       // 其他 push "..." 指令
+	Disable                    // disable
+	Other                      // 其他指令 原样保留
+)
+
+const (
+	// DefaultNetmask 路由未指定掩码时 OpenVPN 默认的主机掩码
+	DefaultNetmask = "255.255.255.255"
+)
+
+// Route 路由 用于 push "route" 与 iroute
+type Route struct {
+	Network string
+	Netmask string
+	Gateway string // 仅 push "route" 可选
+	Metric  string // 仅 push "route" 可选
+}
+
+// Ifconfig 用户虚拟IP配置
+type Ifconfig struct {
+	Local   string // 用户虚拟IP
+	Netmask string // subnet 拓扑下为子网掩码
+}
+
+// DhcpOption push "dhcp-option" 指令
+type DhcpOption struct {
+	Type  string // DNS、DOMAIN 等
+	Value string
+}
+
+// Line ccd文件中的一行
+type Line struct {
+	Kind     Kind
+	Route    Route      // PushRoute、Iroute
+	Ifconfig Ifconfig   // IfconfigPush
+	Option   DhcpOption // PushDhcpOption
+	Text     string     // Comment 为注释内容(含注释符)，Push、Other 为指令原文
+	raw      string     // 解析时的原始文本 未修改的行原样输出
+}
+
+// File ccd文件
+type File struct {
+	Lines []*Line
+	eol   bool // 文件是否以换行结尾
+}
+
+// New 新建空的ccd文件
+func New() *File {
+	return &File{eol: true}
+}
+
+// Key 路由的唯一标识 未指定掩码按主机路由处理
+func (r Route) Key() string {
+	mask := r.Netmask
+	if mask == "" {
+		mask = DefaultNetmask
+	}
+	return r.Network + " " + mask
+}
+
+// String 路由的 network netmask 形式
+func (r Route) String() string {
+	return r.Key()
+}
+
+// Parse 解析ccd文件
+func Parse(r io.Reader) (*File, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseString(string(data)), nil
+}
+
+// ParseString 解析ccd文件内容
+func ParseString(s string) *File {
+	f := New()
+	if s == "" {
+		return f
+	}
+	f.eol = strings.HasSuffix(s, "\n")
+	s = strings.TrimSuffix(s, "\n")
+	for _, raw := range strings.Split(s, "\n") {
+		line := parseLine(raw)
+		line.raw = raw
+		f.Lines = append(f.Lines, line)
+	}
+	return f
+}
+
+// parseLine 解析单行 无法识别或参数不全的指令按 Other 原样保留
+func parseLine(raw string) *Line {
+	text := strings.TrimSpace(raw)
+	if text == "" {
+		return &Line{Kind: Blank}
+	}
+	if strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+		return &Line{Kind: Comment, Text: text}
+	}
+
+	other := &Line{Kind: Other, Text: text}
+	tokens := tokenize(text)
+	switch tokens[0] {
+	case "disable":
+		return &Line{Kind: Disable}
+	case "ifconfig-push":
+		if len(tokens) < 3 {
+			return other
+		}
+		return &Line{Kind: IfconfigPush, Ifconfig: Ifconfig{Local: tokens[1], Netmask: tokens[2]}}
+	case "iroute":
+		if len(tokens) < 2 {
+			return other
+		}
+		route := Route{Network: tokens[1]}
+		if len(tokens) > 2 {
+			route.Netmask = tokens[2]
+		}
+		return &Line{Kind: Iroute, Route: route}
+	case "push":
+		if len(tokens) < 2 {
+			return other
+		}
+		args := strings.Fields(tokens[1])
+		if len(args) == 0 {
+			return other
+		}
+		switch args[0] {
+		case "route":
+			if len(args) < 2 {
+				return other
+			}
+			route := Route{Network: args[1]}
+			if len(args) > 2 {
+				route.Netmask = args[2]
+			}
+			if len(args) > 3 {
+				route.Gateway = args[3]
+			}
+			if len(args) > 4 {
+				route.Metric = args[4]
+			}
+			return &Line{Kind: PushRoute, Route: route}
+		case "dhcp-option":
+			if len(args) < 2 {
+				return other
+			}
+			return &Line{Kind: PushDhcpOption, Option: DhcpOption{Type: args[1], Value: strings.Join(args[2:], " ")}}
+		}
+		return &Line{Kind: Push, Text: text}
+	}
+	return other
+}
+
+// tokenize 按空白切分 双引号内的内容作为一个参数
+func tokenize(s string) (tokens []string) {
+	var cur strings.Builder
+	inQuote, hasToken := false, false
+	for _, c := range s {
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+			hasToken = true
+		case !inQuote && (c == ' ' || c == '\t' || c == '\r'):
+			if hasToken {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+				hasToken = false
+			}
+		default:
+			cur.WriteRune(c)
+			hasToken = true
+		}
+	}
+	if hasToken {
+		tokens = append(tokens, cur.String())
+	}
+	return
+}
+
+// String 渲染单行
+func (l *Line) String() string {
+	if l.raw != "" {
+		return l.raw
+	}
+	switch l.Kind {
+	case Comment, Push, Other:
+		return l.Text
+	case Disable:
+		return "disable"
+	case IfconfigPush:
+		return fmt.Sprintf("ifconfig-push %s %s", l.Ifconfig.Local, l.Ifconfig.Netmask)
+	case Iroute:
+		return strings.TrimSpace(fmt.Sprintf("iroute %s %s", l.Route.Network, l.Route.Netmask))
+	case PushRoute:
+		args := []string{"route", l.Route.Network}
+		for _, arg := range []string{l.Route.Netmask, l.Route.Gateway, l.Route.Metric} {
+			if arg == "" {
+				break
+			}
+			args = append(args, arg)
+		}
+		return fmt.Sprintf(`push "%s"`, strings.Join(args, " "))
+	case PushDhcpOption:
+		return strings.TrimSpace(fmt.Sprintf(`push "dhcp-option %s %s"`, l.Option.Type, l.Option.Value))
+	}
+	return ""
+}
+
+// String 渲染整个文件
+func (f *File) String() string {
+	lines := make([]string, 0, len(f.Lines))
+	for _, line := range f.Lines {
+		lines = append(lines, line.String())
+	}
+	s := strings.Join(lines, "\n")
+	if f.eol && len(lines) > 0 {
+		s += "\n"
+	}
+	return s
+}
+
+// Ifconfig 用户的虚拟IP配置
+func (f *File) Ifconfig() (Ifconfig, bool) {
+	for _, line := range f.Lines {
+		if line.Kind == IfconfigPush {
+			return line.Ifconfig, true
+		}
+	}
+	return Ifconfig{}, false
+}
+
+// VIP 用户的虚拟IP 未配置时为空
+func (f *File) VIP() string {
+	ifconfig, _ := f.Ifconfig()
+	return ifconfig.Local
+}
+
+// SetIfconfig 设置用户虚拟IP 已存在则覆盖 否则插入到文件开头
+func (f *File) SetIfconfig(ifconfig Ifconfig) {
+	for _, line := range f.Lines {
+		if line.Kind == IfconfigPush {
+			line.Ifconfig = ifconfig
+			line.raw = ""
+			return
+		}
+	}
+	f.Lines = append([]*Line{{Kind: IfconfigPush, Ifconfig: ifconfig}}, f.Lines...)
+}
+
+// Routes 推送给用户的路由
+func (f *File) Routes() (routes []Route) {
+	for _, line := range f.Lines {
+		if line.Kind == PushRoute {
+			routes = append(routes, line.Route)
+		}
+	}
+	return
+}
+
+// AddRoute 在文件末尾追加路由
+func (f *File) AddRoute(route Route) {
+	f.Lines = append(f.Lines, &Line{Kind: PushRoute, Route: route})
+}
+
+// HasRoute 路由是否已推送给用户 按 network netmask 比较
+func (f *File) HasRoute(route Route) bool {
+	for _, r := range f.Routes() {
+		if r.Key() == route.Key() {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeRoutes 合并路由 仅追加文件中尚不存在的路由，重复的路由跳过
+func (f *File) MergeRoutes(routes []Route) (added, skipped []Route) {
+	for _, route := range routes {
+		if f.HasRoute(route) {
+			skipped = append(skipped, route)
+			continue
+		}
+		f.AddRoute(route)
+		added = append(added, route)
+	}
+	return
+}
+
+// RemoveRoutes 删除路由 返回实际删除的路由与文件中本就不存在的路由
+func (f *File) RemoveRoutes(routes []Route) (removed, missing []Route) {
+	keys := map[string]bool{}
+	for _, route := range routes {
+		if f.HasRoute(route) {
+			if !keys[route.Key()] {
+				removed = append(removed, route)
+			}
+			keys[route.Key()] = true
+		} else {
+			missing = append(missing, route)
+		}
+	}
+	f.removeRouteLines(keys)
+	return
+}
+
+// ReplaceRoutes 用给定路由替换全部路由 已存在的路由行保持不动，其他指令不受影响
+func (f *File) ReplaceRoutes(routes []Route) (added, removed []Route) {
+	keep := map[string]bool{}
+	for _, route := range routes {
+		keep[route.Key()] = true
+	}
+	drop := map[string]bool{}
+	for _, route := range f.Routes() {
+		if !keep[route.Key()] && !drop[route.Key()] {
+			drop[route.Key()] = true
+			removed = append(removed, route)
+		}
+	}
+	f.removeRouteLines(drop)
+	added, _ = f.MergeRoutes(routes)
+	return
+}
+
+// removeRouteLines 删除 key 在集合内的 push "route" 行
+func (f *File) removeRouteLines(keys map[string]bool) {
+	if len(keys) == 0 {
+		return
+	}
+	lines := f.Lines[:0]
+	for _, line := range f.Lines {
+		if line.Kind == PushRoute && keys[line.Route.Key()] {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	f.Lines = lines
+}
+
+// Normalize 规范化ccd文件 返回删除的重复路由
+// 已识别的指令按标准格式重新渲染(未指定掩码的路由补全为主机路由掩码)，重复的路由只保留第一条，文件以换行结尾; 注释与其他指令原样保留
+func (f *File) Normalize() (duplicates []Route) {
+	seen := map[string]bool{}
+	lines := f.Lines[:0]
+	for _, line := range f.Lines {
+		switch line.Kind {
+		case PushRoute:
+			if seen[line.Route.Key()] {
+				duplicates = append(duplicates, line.Route)
+				continue
+			}
+			seen[line.Route.Key()] = true
+			if line.Route.Netmask == "" {
+				line.Route.Netmask = DefaultNetmask
+			}
+			line.raw = ""
+		case IfconfigPush, Iroute, PushDhcpOption, Disable:
+			line.raw = ""
+		}
+		lines = append(lines, line)
+	}
+	f.Lines = lines
+	if len(f.Lines) > 0 {
+		f.eol = true
+	}
+	return
+}
+
+// Iroutes 用户侧子网路由
+func (f *File) Iroutes() (routes []Route) {
+	for _, line := range f.Lines {
+		if line.Kind == Iroute {
+			routes = append(routes, line.Route)
+		}
+	}
+	return
+}
+
+// DhcpOptions 推送给用户的dhcp选项
+func (f *File) DhcpOptions() (options []DhcpOption) {
+	for _, line := range f.Lines {
+		if line.Kind == PushDhcpOption {
+			options = append(options, line.Option)
+		}
+	}
+	return
+}
+
+// Disabled 用户是否被禁用
+func (f *File) Disabled() bool {
+	for _, line := range f.Lines {
+		if line.Kind == Disable {
+			return true
+		}
+	}
+	return false
+}
+
+// SetDisabled 写入或移除 disable 指令
+func (f *File) SetDisabled(disabled bool) {
+	if disabled {
+		if !f.Disabled() {
+			f.Lines = append(f.Lines, &Line{Kind: Disable})
+		}
+		return
+	}
+	lines := f.Lines[:0]
+	for _, line := range f.Lines {
+		if line.Kind != Disable {
+			lines = append(lines, line)
+		}
+	}
+	f.Lines = lines
+}
+
+// Load 读取并解析ccd文件
+func Load(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(file)
+}
+
+// Update 加排他锁读取ccd文件(不存在则新建)，经 fn 修改后原子写回
+// 写入时先写同目录下的临时文件并落盘，再重命名覆盖原文件，避免 OpenVPN 读到写了一半的文件
+func Update(path string, fn func(f *File) error) (err error) {
+	// 临时文件重命名后原文件的inode会变化，因此锁加在所在目录上
+	unlock, err := lockDir(filepath.Dir(path))
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	f, mode := New(), os.FileMode(0644)
+	info, err := os.Stat(path)
+	if err == nil {
+		mode = info.Mode().Perm()
+		if f, err = Load(path); err != nil {
+			return
+		}
+	} else if !os.IsNotExist(err) {
+		return
+	}
+
+	if err = fn(f); err != nil {
+		return
+	}
+	return writeFile(path, []byte(f.String()), mode)
+}
+
+// Move 加排他锁将ccd文件移动到 dst 避免与 Update 同时修改 dst 已存在时返回错误
+func Move(path, dst string) (err error) {
+	unlock, err := lockDir(filepath.Dir(path))
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	if _, err = os.Stat(path); err != nil {
+		return
+	}
+	if _, err = os.Lstat(dst); err == nil {
+		return os.ErrExist
+	}
+	return os.Rename(path, dst)
+}
+
+// Remove 加排他锁删除ccd文件 返回删除前的内容 避免与 Update 同时修改
+func Remove(path string) (f *File, err error) {
+	unlock, err := lockDir(filepath.Dir(path))
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	if f, err = Load(path); err != nil {
+		return
+	}
+	return f, os.Remove(path)
+}
+
+// lockDir 阻塞模式下对目录加排他锁
+func lockDir(dir string) (unlock func(), err error) {
+	file, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "add exclusive lock in block failed")
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// writeFile 写临时文件、fsync 后重命名覆盖目标文件
+func writeFile(path string, data []byte, mode os.FileMode) (err error) {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return errors.Wrap(err, "Fail to write ccd file")
+	}
+	if err = tmp.Sync(); err != nil {
+		return errors.Wrap(err, "Fail to sync ccd file")
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return
+	}
+
+	// 目录落盘 保证重命名持久化
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	return d.Sync()
+}
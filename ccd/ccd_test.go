@@ -0,0 +1,254 @@
+package ccd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const sample = `# 王二小
+ifconfig-push 10.11.3.164 255.255.0.0
+
+push "route 10.16.3.0 255.255.255.0"
+push  "route 192.168.5.9 255.255.255.255"
+push "route 172.16.0.0 255.240.0.0 vpn_gateway 10"
+iroute 192.168.100.0 255.255.255.0
+push "dhcp-option DNS 10.11.0.1"
+push "redirect-gateway def1"
+; 临时禁用
+disable
+comp-lzo no
+`
+
+// 解析后原样渲染
+func TestRoundTrip(t *testing.T) {
+	for _, s := range []string{sample, "", "ifconfig-push 10.11.0.2 255.255.0.0", "\n\npush \"route 10.0.0.0\"\r\n"} {
+		if got := ParseString(s).String(); got != s {
+			t.Errorf("round trip mismatch:\nwant %q\ngot  %q", s, got)
+		}
+	}
+}
+
+// 各类指令解析
+func TestParse(t *testing.T) {
+	f := ParseString(sample)
+
+	if ifconfig, ok := f.Ifconfig(); !ok || ifconfig != (Ifconfig{Local: "10.11.3.164", Netmask: "255.255.0.0"}) {
+		t.Errorf("Ifconfig() = %v, %v", ifconfig, ok)
+	}
+	if vip := f.VIP(); vip != "10.11.3.164" {
+		t.Errorf("VIP() = %q", vip)
+	}
+
+	wantRoutes := []Route{
+		{Network: "10.16.3.0", Netmask: "255.255.255.0"},
+		{Network: "192.168.5.9", Netmask: "255.255.255.255"},
+		{Network: "172.16.0.0", Netmask: "255.240.0.0", Gateway: "vpn_gateway", Metric: "10"},
+	}
+	if routes := f.Routes(); !reflect.DeepEqual(routes, wantRoutes) {
+		t.Errorf("Routes() = %v", routes)
+	}
+	if iroutes := f.Iroutes(); !reflect.DeepEqual(iroutes, []Route{{Network: "192.168.100.0", Netmask: "255.255.255.0"}}) {
+		t.Errorf("Iroutes() = %v", iroutes)
+	}
+	if options := f.DhcpOptions(); !reflect.DeepEqual(options, []DhcpOption{{Type: "DNS", Value: "10.11.0.1"}}) {
+		t.Errorf("DhcpOptions() = %v", options)
+	}
+	if !f.Disabled() {
+		t.Error("Disabled() = false")
+	}
+
+	kinds := []Kind{Comment, IfconfigPush, Blank, PushRoute, PushRoute, PushRoute, Iroute, PushDhcpOption, Push, Comment, Disable, Other}
+	if len(f.Lines) != len(kinds) {
+		t.Fatalf("got %d lines, want %d", len(f.Lines), len(kinds))
+	}
+	for i, kind := range kinds {
+		if f.Lines[i].Kind != kind {
+			t.Errorf("line %d kind = %v, want %v", i, f.Lines[i].Kind, kind)
+		}
+	}
+}
+
+// 修改后只重新渲染改动的行
+func TestModify(t *testing.T) {
+	f := ParseString("ifconfig-push 10.11.0.2 255.255.0.0\npush  \"route 10.0.0.0 255.0.0.0\"\ndisable\n")
+	f.SetIfconfig(Ifconfig{Local: "10.11.0.3", Netmask: "255.255.0.0"})
+	f.AddRoute(Route{Network: "192.168.5.9", Netmask: DefaultNetmask})
+	f.SetDisabled(false)
+
+	want := "ifconfig-push 10.11.0.3 255.255.0.0\npush  \"route 10.0.0.0 255.0.0.0\"\npush \"route 192.168.5.9 255.255.255.255\"\n"
+	if got := f.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	f = New()
+	f.SetIfconfig(Ifconfig{Local: "10.11.0.4", Netmask: "255.255.0.0"})
+	f.SetDisabled(true)
+	if got, want := f.String(), "ifconfig-push 10.11.0.4 255.255.0.0\ndisable\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// 文件不存在时新建
+func TestUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wangerxiao")
+	for i := 0; i < 2; i++ {
+		err := Update(path, func(f *File) error {
+			f.AddRoute(Route{Network: "10.16.3.0", Netmask: "255.255.255.0"})
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "push \"route 10.16.3.0 255.255.255.0\"\npush \"route 10.16.3.0 255.255.255.0\"\n"
+	if string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+}
+
+// 合并路由 已存在的路由不重复追加
+func TestMergeRoutes(t *testing.T) {
+	f := ParseString("ifconfig-push 10.11.0.2 255.255.0.0\npush \"route 192.168.5.9\"\n")
+	added, skipped := f.MergeRoutes([]Route{
+		{Network: "192.168.5.9", Netmask: DefaultNetmask},
+		{Network: "10.16.3.0", Netmask: "255.255.255.0"},
+		{Network: "10.16.3.0", Netmask: "255.255.255.0"},
+	})
+
+	if !reflect.DeepEqual(added, []Route{{Network: "10.16.3.0", Netmask: "255.255.255.0"}}) {
+		t.Errorf("added = %v", added)
+	}
+	if len(skipped) != 2 {
+		t.Errorf("skipped = %v", skipped)
+	}
+	if routes := f.Routes(); len(routes) != 2 {
+		t.Errorf("Routes() = %v", routes)
+	}
+}
+
+// 规范化格式并删除重复路由
+func TestNormalize(t *testing.T) {
+	f := ParseString("# 王二小\nifconfig-push  10.11.0.2   255.255.0.0\npush \"route 192.168.5.9\"\npush  \"route 192.168.5.9 255.255.255.255\"\ncomp-lzo  no")
+	duplicates := f.Normalize()
+	if len(duplicates) != 1 || duplicates[0].Key() != "192.168.5.9 255.255.255.255" {
+		t.Errorf("duplicates = %v", duplicates)
+	}
+	want := "# 王二小\nifconfig-push 10.11.0.2 255.255.0.0\npush \"route 192.168.5.9 255.255.255.255\"\ncomp-lzo  no\n"
+	if got := f.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if duplicates = f.Normalize(); len(duplicates) != 0 || f.String() != want {
+		t.Errorf("Normalize() should be idempotent")
+	}
+}
+
+// 回收与替换路由
+func TestRemoveAndReplaceRoutes(t *testing.T) {
+	f := ParseString("ifconfig-push 10.11.0.2 255.255.0.0\npush \"route 192.168.5.9\"\npush \"route 10.16.3.0 255.255.255.0\"\n")
+	removed, missing := f.RemoveRoutes([]Route{
+		{Network: "192.168.5.9", Netmask: DefaultNetmask},
+		{Network: "192.168.5.8", Netmask: DefaultNetmask},
+	})
+	if len(removed) != 1 || len(missing) != 1 {
+		t.Errorf("removed = %v, missing = %v", removed, missing)
+	}
+	if got, want := f.String(), "ifconfig-push 10.11.0.2 255.255.0.0\npush \"route 10.16.3.0 255.255.255.0\"\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	added, removed := f.ReplaceRoutes([]Route{
+		{Network: "10.16.3.0", Netmask: "255.255.255.0"},
+		{Network: "122.112.146.97", Netmask: DefaultNetmask},
+	})
+	if len(added) != 1 || len(removed) != 0 {
+		t.Errorf("added = %v, removed = %v", added, removed)
+	}
+	added, removed = f.ReplaceRoutes(nil)
+	if len(added) != 0 || len(removed) != 2 || len(f.Routes()) != 0 {
+		t.Errorf("added = %v, removed = %v, routes = %v", added, removed, f.Routes())
+	}
+	if got, want := f.String(), "ifconfig-push 10.11.0.2 255.255.0.0\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// 原子写回 保留原文件权限且不残留临时文件
+func TestUpdateAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "wangerxiao")
+	if err := ioutil.WriteFile(path, []byte("ifconfig-push 10.11.0.2 255.255.0.0\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Update(path, func(f *File) error {
+		f.AddRoute(Route{Network: "10.16.3.0", Netmask: "255.255.255.0"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+
+	// fn 返回错误时不修改原文件
+	err = Update(path, func(f *File) error {
+		f.SetDisabled(true)
+		return errors.New("abort")
+	})
+	if err == nil {
+		t.Error("want error from fn")
+	}
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Disabled() || len(f.Routes()) != 1 {
+		t.Errorf("unexpected content %q", f.String())
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("temp files left behind: %d files", len(files))
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before := "ifconfig-push 10.11.0.2 255.255.0.0\npush \"route 10.16.3.0 255.255.255.0\"\npush \"route 192.168.5.9 255.255.255.255\"\n"
+	after := "ifconfig-push 10.11.0.2 255.255.0.0\npush \"route 192.168.5.9 255.255.255.255\"\npush \"route 10.16.4.0 255.255.255.0\"\n"
+	want := `--- a/zhangsan
++++ b/zhangsan
+ ifconfig-push 10.11.0.2 255.255.0.0
+-push "route 10.16.3.0 255.255.255.0"
+ push "route 192.168.5.9 255.255.255.255"
++push "route 10.16.4.0 255.255.255.0"
+`
+	if got := Diff("a/zhangsan", "b/zhangsan", before, after); got != want {
+		t.Errorf("Diff =\n%s\nwant\n%s", got, want)
+	}
+	if got := Diff("/dev/null", "b/lisi", "", "ifconfig-push 10.11.0.3 255.255.0.0\n"); got != "--- /dev/null\n+++ b/lisi\n+ifconfig-push 10.11.0.3 255.255.0.0\n" {
+		t.Errorf("Diff new file =\n%s", got)
+	}
+	if got := Diff("a", "b", before, before); got != "" {
+		t.Errorf("Diff same = %q", got)
+	}
+}
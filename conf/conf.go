@@ -4,27 +4,38 @@ import (
 	"errors"
 	"fmt"
 	"github.com/fsnotify/fsnotify"
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"mq/uuap"
+	"path/filepath"
 )
 
+// DefaultDir 未指定配置文件时从该目录读取 conf.yaml
+const DefaultDir = "../conf/"
+
 var (
 	Conf     = &uuap.Config{} // 全局配置文件结构体
 	ConfPath string           // 全局配置文件的路径
 )
 
-// Init 初始化配置
+// Dir 配置文件所在目录 配置中的相对路径以该目录为准
+func Dir() string {
+	if ConfPath == "" {
+		return DefaultDir
+	}
+	return filepath.Dir(ConfPath)
+}
+
+// Init 初始化配置 加载或解析失败时返回错误 不修改当前配置
 func Init(path string) (*uuap.Config, error) {
 	cfgFile, err := LoadConfig(path)
 	if err != nil {
-		log.Fatalf("LoadConfig: %v", err)
+		return nil, fmt.Errorf("LoadConfig: %v", err)
 	}
-	Conf, err = ParseConfig(cfgFile)
+	c, err := ParseConfig(cfgFile)
 	if err != nil {
-		log.Fatalf("ParseConfig: %v", err)
+		return nil, fmt.Errorf("ParseConfig: %v", err)
 	}
-
+	Conf = c
 	return Conf, nil
 }
 
@@ -34,7 +45,7 @@ func LoadConfig(path string) (*viper.Viper, error) {
 	if path != "" {
 		v.SetConfigFile(path) // 如果指定了配置文件,则解析指定的配置文件
 	} else {
-		v.AddConfigPath("../conf/")
+		v.AddConfigPath(DefaultDir)
 		v.SetConfigName("conf")
 	}
 	v.SetConfigType("yaml")
@@ -63,10 +74,12 @@ func watchConfig(v *viper.Viper) {
 	v.WatchConfig()
 	v.OnConfigChange(func(event fsnotify.Event) {
 		fmt.Printf("Detect conf change: %s \n", event.String())
-		Conf, err := Init(ConfPath)
+		// 重载失败时保留当前配置
+		c, err := Init(ConfPath)
 		if err != nil {
-			fmt.Printf("Reload cfg error, %s", err)
+			fmt.Printf("Reload cfg error, %s\n", err)
+			return
 		}
-		fmt.Println("重载后的配置文件：", Conf)
+		fmt.Println("重载后的配置文件：", c)
 	})
 }
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"mq/ccd"
+	"mq/ovpn"
+	"mq/schema"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 管理接口:
+//   GET  /api/users/{sam}?instance=  用户当前的路由与VIP
+//   POST /api/grant                  授权 请求体为工单json(可以不带 version)
+//   POST /api/revoke                 回收 请求体为工单json(可以不带 version)
+//   GET  /api/vips/{vip}?instance=   VIP的使用者
+//   POST /api/scan?instance=&format= 扫描ccd文件与ldap用户 format 为 json(默认)或 csv 不隔离文件
+
+// DefaultAdminSpName 管理接口工单未指定工单名时使用
+const DefaultAdminSpName = "管理接口"
+
+// UserCCD 用户当前的权限 由ccd文件解析
+type UserCCD struct {
+	Instance string   `json:"instance"`
+	Sam      string   `json:"sam"`
+	Vip      string   `json:"vip"`
+	Routes   []string `json:"routes"`
+	Iroutes  []string `json:"iroutes,omitempty"`
+	Disabled bool     `json:"disabled"`
+}
+
+// VipOwner VIP的使用者 未分配时 Owner 为空
+type VipOwner struct {
+	Instance string `json:"instance"`
+	Vip      string `json:"vip"`
+	Owner    string `json:"owner"`
+}
+
+// errNotFound 查询的对象不存在
+var errNotFound = errors.New("not found")
+
+// validSam 账号名可以作为ccd文件名 不能跳出ccd目录
+func validSam(sam string) bool {
+	return sam != "" && sam != "." && sam != ".." && !strings.ContainsAny(sam, `/\`)
+}
+
+// isCCDFile ccd目录下的用户ccd文件 跳过子目录与隐藏文件(如 ccd.Update 写入中的临时文件)
+func isCCDFile(info os.FileInfo) bool {
+	return !info.IsDir() && validSam(info.Name()) && info.Name()[0] != '.'
+}
+
+// LoadUserCCD 解析实例中用户的ccd文件
+func LoadUserCCD(inst *ovpn.Instance, sam string) (*UserCCD, error) {
+	if !validSam(sam) {
+		return nil, fmt.Errorf("账号名不合法: %q", sam)
+	}
+	f, err := ccd.Load(inst.CCDFilePath(sam))
+	if os.IsNotExist(err) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newUserCCD(inst, sam, f), nil
+}
+
+// newUserCCD 由解析后的ccd文件生成 UserCCD
+func newUserCCD(inst *ovpn.Instance, sam string, f *ccd.File) *UserCCD {
+	return &UserCCD{
+		Instance: inst.Name,
+		Sam:      sam,
+		Vip:      f.VIP(),
+		Routes:   routeStrings(f.Routes()),
+		Iroutes:  routeStrings(f.Iroutes()),
+		Disabled: f.Disabled(),
+	}
+}
+
+// LookupVip 查询VIP的使用者 未指定实例时查询VIP池包含该VIP的实例 各实例的VIP池不重叠 最多一个
+func LookupVip(instance, vip string) (owners []*VipOwner, err error) {
+	var insts []*ovpn.Instance
+	if instance != "" {
+		inst, err := GetInstance(instance)
+		if err != nil {
+			return nil, err
+		}
+		insts = append(insts, inst)
+	} else {
+		for _, inst := range sortedInstances() {
+			if inst.Allocator.Pool.Contains(vip) {
+				insts = append(insts, inst)
+			}
+		}
+		if len(insts) == 0 {
+			return nil, errNotFound
+		}
+	}
+
+	for _, inst := range insts {
+		owner, err := inst.Allocator.Owner(vip)
+		if err != nil {
+			return nil, err
+		}
+		owners = append(owners, &VipOwner{Instance: inst.Name, Vip: vip, Owner: owner})
+	}
+	return
+}
+
+// sortedInstances 按名称排序的实例列表
+func sortedInstances() (insts []*ovpn.Instance) {
+	for _, inst := range Instances {
+		insts = append(insts, inst)
+	}
+	sort.Slice(insts, func(i, j int) bool { return insts[i].Name < insts[j].Name })
+	return
+}
+
+// StartAdminServer 后台启动管理接口
+func StartAdminServer(addr, token string) {
+	if token == "" {
+		log.Warning("[管理接口]未配置 Token，能访问 " + addr + " 的人都可以修改权限")
+	}
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      NewAdminHandler(token),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: time.Minute,
+	}
+	go func() {
+		log.Info("[管理接口]监听 " + addr)
+		if err := srv.ListenAndServe(); err != nil {
+			log.Error("[管理接口]退出: ", err)
+		}
+	}()
+}
+
+// NewAdminHandler 管理接口 token 不为空时校验 Authorization: Bearer <token>
+func NewAdminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/users/", adminUser)
+	mux.HandleFunc("/api/grant", adminOrder(schema.OperationGrant))
+	mux.HandleFunc("/api/revoke", adminOrder(schema.OperationRevoke))
+	mux.HandleFunc("/api/vips/", adminVip)
+	mux.HandleFunc("/api/scan", adminScan)
+	if token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// adminUser 用户当前的路由与VIP DELETE 时删除用户的ccd文件并回收VIP
+func adminUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, errors.New(r.Method+" not allowed"))
+		return
+	}
+	inst, err := GetInstance(r.URL.Query().Get("instance"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	sam := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	var user *UserCCD
+	if r.Method == http.MethodDelete {
+		user, err = RemoveCCD4User(inst, sam, SourceAdmin)
+	} else {
+		user, err = LoadUserCCD(inst, sam)
+	}
+	switch {
+	case err == errNotFound:
+		writeError(w, http.StatusNotFound, fmt.Errorf("实例[%s]中没有账号[%s]的ccd文件", inst.Name, sam))
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeJSON(w, http.StatusOK, user)
+	}
+}
+
+// adminOrder 按工单授权或回收 与MQ工单走同一处理流程 不回复到回复主题
+func adminOrder(operation string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, errors.New(r.Method+" not allowed"))
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		// 请求体使用当前版本的字段名 可以不带 version
+		order := &schema.UVPNAuthority{}
+		if err = json.Unmarshal(body, order); err != nil {
+			writeError(w, http.StatusBadRequest, Permanent(ReasonBadMessage, err))
+			return
+		}
+		order.Version, order.Operation = schema.Version, operation
+		if order.SpName == "" {
+			order.SpName = DefaultAdminSpName
+		}
+
+		log.Info(fmt.Sprintf("[管理接口]工单名[%s] 操作[%s] 实例[%s] 工号[%s] 来源[%s]",
+			order.SpName, order.Operation, order.Instance, order.Eid, r.RemoteAddr))
+		result, err := ApplyOrder(order, SourceAdmin, "")
+		result.SetError(err)
+		if err != nil {
+			log.Error("[管理接口]", err)
+		}
+		writeJSON(w, orderStatus(err), result)
+	}
+}
+
+// orderStatus 处理工单的错误对应的状态码
+func orderStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if permanent, ok := IsPermanent(err); ok {
+		switch permanent.Reason {
+		case ReasonUnknownInstance, ReasonUserNotFound:
+			return http.StatusNotFound
+		}
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// adminVip VIP的使用者
+func adminVip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New(r.Method+" not allowed"))
+		return
+	}
+	vip := strings.TrimPrefix(r.URL.Path, "/api/vips/")
+	owners, err := LookupVip(r.URL.Query().Get("instance"), vip)
+	switch {
+	case err == errNotFound:
+		writeError(w, http.StatusNotFound, fmt.Errorf("没有实例的VIP池包含[%s]", vip))
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeJSON(w, http.StatusOK, owners)
+	}
+}
+
+// adminScan 扫描ccd文件与ldap用户 未指定实例时扫描所有实例
+func adminScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New(r.Method+" not allowed"))
+		return
+	}
+	insts := sortedInstances()
+	if name := r.URL.Query().Get("instance"); name != "" {
+		inst, err := GetInstance(name)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		insts = []*ovpn.Instance{inst}
+	}
+
+	entries := []*CCDScanEntry{}
+	for _, inst := range insts {
+		instEntries, err := ScanUVPNUserCCD(inst)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		entries = append(entries, instEntries...)
+	}
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		if err := WriteScanCSV(w, entries); err != nil {
+			log.Error("[管理接口]Fail to write response, err: ", err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("[管理接口]Fail to write response, err: ", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
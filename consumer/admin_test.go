@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-ldap/ldap/v3"
+	"mq/uuap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// adminRequest 请求管理接口 返回状态码并解码响应
+func adminRequest(t *testing.T, h http.Handler, method, path, token, body string, v interface{}) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v\n%s", method, path, err, rec.Body)
+		}
+	}
+	return rec.Code
+}
+
+// 授权、查询用户、查询VIP、回收与扫描
+func TestAdminAPI(t *testing.T) {
+	_, dir := setupConsumer(t, 0)
+	h := NewAdminHandler("secret")
+
+	if code := adminRequest(t, h, http.MethodGet, "/api/users/zhangsan", "", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("without token: %d", code)
+	}
+	for _, auth := range []string{"secret", "Basic secret", "Bearer wrong"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/zhangsan", nil)
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: %d", auth, rec.Code)
+		}
+	}
+
+	var result UVPNResult
+	code := adminRequest(t, h, http.MethodPost, "/api/grant", "secret",
+		`{"eid":"1001","displayName":"张三","destIps":[{"destIp":"10.16.3.0/24"},{"destIp":"192.168.5.9"}]}`, &result)
+	if code != http.StatusOK || !result.Success || result.Sam != "zhangsan" || result.Vip != "10.11.0.2" || result.SpName != DefaultAdminSpName || len(result.Added) != 2 {
+		t.Fatalf("grant: %d %+v", code, result)
+	}
+
+	var user UserCCD
+	if code = adminRequest(t, h, http.MethodGet, "/api/users/zhangsan", "secret", "", &user); code != http.StatusOK {
+		t.Fatalf("get user: %d", code)
+	}
+	if user.Vip != "10.11.0.2" || len(user.Routes) != 2 || user.Routes[1] != "192.168.5.9 255.255.255.255" || user.Instance != "default" {
+		t.Errorf("user = %+v", user)
+	}
+	for _, path := range []string{"/api/users/lisi", "/api/users/..", "/api/users/zhangsan?instance=tcp"} {
+		if code = adminRequest(t, h, http.MethodGet, path, "secret", "", nil); code == http.StatusOK {
+			t.Errorf("GET %s: %d", path, code)
+		}
+	}
+
+	var owners []*VipOwner
+	if code = adminRequest(t, h, http.MethodGet, "/api/vips/10.11.0.2", "secret", "", &owners); code != http.StatusOK || len(owners) != 1 || owners[0].Owner != "zhangsan" {
+		t.Errorf("vip lookup: %d %+v", code, owners)
+	}
+	if code = adminRequest(t, h, http.MethodGet, "/api/vips/10.12.0.2", "secret", "", nil); code != http.StatusNotFound {
+		t.Errorf("vip outside pools: %d", code)
+	}
+
+	// 回收时忽略请求体中的操作类型
+	result = UVPNResult{}
+	code = adminRequest(t, h, http.MethodPost, "/api/revoke", "secret",
+		`{"eid":"1001","displayName":"张三","operation":"grant","destIps":[{"destIp":"192.168.5.9"}]}`, &result)
+	if code != http.StatusOK || result.Operation != "revoke" || len(result.Removed) != 1 {
+		t.Errorf("revoke: %d %+v", code, result)
+	}
+	result = UVPNResult{}
+	code = adminRequest(t, h, http.MethodPost, "/api/grant", "secret",
+		`{"eid":"9999","displayName":"李四","destIps":[{"destIp":"192.168.5.9"}]}`, &result)
+	if code != http.StatusNotFound || result.Success || result.Error == "" {
+		t.Errorf("grant unknown user: %d %+v", code, result)
+	}
+	if code = adminRequest(t, h, http.MethodGet, "/api/grant", "secret", "", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /api/grant: %d", code)
+	}
+
+	// 扫描 机器账号的ccd文件没有ldap用户
+	writeCCDFiles(t, dir, map[string]string{"robot": "ifconfig-push 10.11.0.9 255.255.0.0\n"})
+	fetchLdapUsers = func(user *uuap.LdapAttributes) ([]*ldap.Entry, error) {
+		return []*ldap.Entry{ldap.NewEntry("CN=张三,DC=x,DC=com", map[string][]string{
+			"sAMAccountName": {"zhangsan"}, "employeeNumber": {"1001"}, "displayName": {"张三"},
+		})}, nil
+	}
+	defer func() { fetchLdapUsers = uuap.FetchLdapUsers }()
+	var entries []*CCDScanEntry
+	if code = adminRequest(t, h, http.MethodPost, "/api/scan", "secret", "", &entries); code != http.StatusOK || len(entries) != 2 {
+		t.Fatalf("scan: %d %+v", code, entries)
+	}
+	if e := entries[0]; e.File != "robot" || !e.Orphan || e.Vip != "10.11.0.9" {
+		t.Errorf("entries[0] = %+v", e)
+	}
+	if e := entries[1]; e.File != "zhangsan" || e.Orphan || e.Eid != "1001" || e.Vip != "10.11.0.2" {
+		t.Errorf("entries[1] = %+v", e)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "robot")); err != nil {
+		t.Error("scan should not remove files")
+	}
+
+	// 删除用户 回收VIP供新用户复用; 不是VIP使用者的ccd文件只删除不回收
+	user = UserCCD{}
+	if code = adminRequest(t, h, http.MethodDelete, "/api/users/zhangsan", "secret", "", &user); code != http.StatusOK || user.Vip != "10.11.0.2" {
+		t.Fatalf("delete user: %d %+v", code, user)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "zhangsan")); !os.IsNotExist(err) {
+		t.Error("ccd file should be removed")
+	}
+	if code = adminRequest(t, h, http.MethodDelete, "/api/users/zhangsan", "secret", "", nil); code != http.StatusNotFound {
+		t.Errorf("delete missing user: %d", code)
+	}
+	if code = adminRequest(t, h, http.MethodDelete, "/api/users/robot", "secret", "", nil); code != http.StatusOK {
+		t.Errorf("delete robot: %d", code)
+	}
+	if vips, err := DefaultInstance.Allocator.Preview(2); err != nil || len(vips) != 2 || vips[0] != "10.11.0.2" || vips[1] != "10.11.0.3" {
+		t.Errorf("Preview after delete = %v, %v", vips, err)
+	}
+	if vip, err := DefaultInstance.Allocator.Allocate("lisi"); err != nil || vip != "10.11.0.2" {
+		t.Errorf("Allocate after delete = %s, %v", vip, err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"mq/audit"
+	"mq/conf"
+	"mq/uuap"
+	"path/filepath"
+	"time"
+)
+
+// 审计记录的变更来源
+const (
+	SourceMQ          = "mq"
+	SourceAdmin       = "admin"
+	SourceCLI         = "cli"
+	SourceExpire      = "expire"
+	SourceAccountSync = "account-sync"
+	SourceScan        = "scan"
+)
+
+// auditStore 审计记录存储 未启用时为 nil
+var auditStore audit.Store
+
+// InitAudit 按配置初始化审计记录存储 redis 存储需先初始化缓存
+func InitAudit(c *uuap.Config) error {
+	switch c.Audit.Driver {
+	case "", "file":
+		path, err := auditPath(c.Audit.Path)
+		if err != nil {
+			return err
+		}
+		auditStore = audit.NewFileStore(path)
+	case "redis":
+		auditStore = audit.NewRedisStore(c.Audit.Key)
+	case "none":
+		auditStore = nil
+	default:
+		return fmt.Errorf("不支持的审计存储: %s", c.Audit.Driver)
+	}
+	return nil
+}
+
+// auditPath 审计文件的绝对路径 相对路径与默认文件名以配置文件所在目录为准 不随工作目录变化
+func auditPath(path string) (string, error) {
+	if path == "" {
+		path = audit.DefaultPath
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(conf.Dir(), path)
+	}
+	return filepath.Abs(path)
+}
+
+// recordAudit 追加审计记录 在ccd文件修改后调用 写入失败时只记录日志 不回滚修改也不重试工单
+func recordAudit(r *audit.Record) {
+	if auditStore == nil {
+		return
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if err := auditStore.Append(r); err != nil {
+		log.Error(fmt.Sprintf("[审计]写入失败 操作[%s] 实例[%s] 账号[%s]: %v", r.Action, r.Instance, r.Sam, err))
+	}
+}
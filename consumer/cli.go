@@ -0,0 +1,699 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mq/audit"
+	"mq/cache"
+	"mq/conf"
+	"mq/firewall"
+	"mq/logger"
+	"mq/ovpn"
+	"mq/schema"
+	"mq/utils"
+	"mq/uuap"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// command 子命令
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+// commands 子命令列表 不指定子命令时为 serve
+var commands = []*command{
+	{"serve", "消费工单 定时回收过期权限与同步AD账户状态 配置了管理接口时启动管理接口", cmdServe},
+	{"scan", "对账ccd文件与ldap用户 可将没有ldap用户的ccd文件隔离", cmdScan},
+	{"sync-disabled", "按AD账户状态禁用或启用用户", cmdSyncDisabled},
+	{"sweep-expired", "立即回收已过期的限时路由", cmdSweepExpired},
+	{"create-user", "为用户生成ccd文件并分配VIP", cmdCreateUser},
+	{"show-user", "查看用户当前的路由与VIP", cmdShowUser},
+	{"delete-user", "删除用户的ccd文件并回收VIP", cmdDeleteUser},
+	{"grant", "为用户授权", cmdOrder(schema.OperationGrant)},
+	{"revoke", "回收用户权限", cmdOrder(schema.OperationRevoke)},
+	{"vip-lookup", "查询VIP的使用者", cmdVipLookup},
+	{"sessions", "查看在线会话及其与ccd文件、VIP分配的对应关系", cmdSessions},
+	{"migrate", "规范化已有ccd文件并由文件中的VIP重建VIP分配状态", cmdMigrate},
+	{"firewall", "由ccd文件生成并应用 nftables 规则", cmdFirewall},
+	{"audit", "按用户或目标IP查询权限变更记录", cmdAudit},
+	{"plan", "重放工单文件 输出每个工单将对ccd文件做的修改 不写入", cmdPlan},
+}
+
+// stringsFlag 可重复指定的参数
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func main() {
+	args := os.Args[1:]
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(args); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "用法: %s [子命令] [参数]\n\n子命令:\n", os.Args[0])
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.name, cmd.usage)
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stderr, "\n子命令的参数见 %s <子命令> -h\n", os.Args[0])
+}
+
+// newFlagSet 子命令的参数 都支持 -config
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return fs, fs.String("config", "", "指定配置文件地址")
+}
+
+// setup 加载配置并初始化日志、实例与缓存 withLdap 时初始化LDAP连接池
+func setup(configPath string, withLdap bool) (err error) {
+	conf.ConfPath = configPath
+	if _, err = conf.Init(conf.ConfPath); err != nil {
+		return
+	}
+
+	if withLdap && (conf.Conf.LdapCfg.ConnUrl == "" || conf.Conf.LdapCfg.AdminAccount == "" || conf.Conf.LdapCfg.BaseDn == "") {
+		return errors.New("LDAP连接信息不可以为空！")
+	}
+
+	// 初始化日志
+	logger.Init()
+
+	// 初始化 OpenVPN 实例及其虚拟IP池
+	if err = InitInstances(conf.Conf); err != nil {
+		return
+	}
+
+	// 初始化LDAP连接池
+	if withLdap {
+		if err = uuap.Init(conf.Conf); err != nil {
+			return
+		}
+	}
+
+	// 初始化缓存
+	if err = cache.Init(&conf.Conf.Redis); err != nil {
+		return
+	}
+
+	// 初始化审计记录
+	return InitAudit(conf.Conf)
+}
+
+// selectInstances 指定实例时只取该实例 否则取全部实例
+func selectInstances(name string) ([]*ovpn.Instance, error) {
+	if name == "" {
+		return sortedInstances(), nil
+	}
+	inst, err := GetInstance(name)
+	if err != nil {
+		return nil, err
+	}
+	return []*ovpn.Instance{inst}, nil
+}
+
+// printJSON 以缩进的json输出到标准输出
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func cmdServe(args []string) error {
+	fs, path := newFlagSet("serve")
+	replayDLQ := fs.Bool("replay-dlq", false, "将死信主题中的消息重新投递到工单主题后退出")
+	dryRun := fs.Bool("dry-run", false, "计划模式 以独立的消费组消费工单 只记录将对ccd文件做的修改 不写入也不回复")
+	fs.Parse(args)
+	if err := setup(*path, true); err != nil {
+		return err
+	}
+
+	// 重放死信队列
+	if *replayDLQ {
+		return ReplayDLQ()
+	}
+
+	// 计划模式不启动定时任务与管理接口
+	if *dryRun {
+		PlanConsumer()
+		return nil
+	}
+
+	// 定时回收过期的限时权限
+	StartExpireSweeper(conf.Conf.System.ExpireSweepInterval)
+
+	// 定时按AD账户状态禁用或启用用户
+	StartDisableSync(conf.Conf.System.DisableSyncInterval)
+
+	// 按ccd文件生成并应用防火墙规则
+	StartFirewallSync()
+
+	// 管理接口
+	if conf.Conf.Admin.Addr != "" {
+		StartAdminServer(conf.Conf.Admin.Addr, conf.Conf.Admin.Token)
+	}
+
+	// 消费者
+	Consumer()
+	return nil
+}
+
+func cmdScan(args []string) error {
+	fs, path := newFlagSet("scan")
+	instance := fs.String("instance", "", "只扫描该实例 为空时扫描全部实例")
+	format := fs.String("format", "text", "输出格式 text/json/csv")
+	cleanup := fs.Bool("cleanup", false, "将没有ldap用户的ccd文件移入隔离目录")
+	maxQuarantine := fs.Int("max-quarantine", DefaultMaxQuarantine, "每个实例单次最多隔离的ccd文件数 超过时不隔离")
+	fs.Parse(args)
+	if *format != "text" && *format != "json" && *format != "csv" {
+		return fmt.Errorf("不支持的输出格式: %s", *format)
+	}
+	if err := setup(*path, true); err != nil {
+		return err
+	}
+	insts, err := selectInstances(*instance)
+	if err != nil {
+		return err
+	}
+
+	entries := []*CCDScanEntry{}
+	for _, inst := range insts {
+		instEntries, err := ScanUVPNUserCCD(inst)
+		if err != nil {
+			return err
+		}
+		if *cleanup {
+			if _, err = QuarantineOrphans(inst, instEntries, *maxQuarantine); err != nil {
+				return err
+			}
+		}
+		entries = append(entries, instEntries...)
+	}
+
+	switch *format {
+	case "json":
+		return printJSON(entries)
+	case "csv":
+		return WriteScanCSV(os.Stdout, entries)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "实例\t账号\t工号\t姓名\tVIP\t备注")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Instance, e.File, e.Eid, e.DisplayName, e.Vip, strings.Join(scanNotes(e), " "))
+	}
+	return w.Flush()
+}
+
+// scanNotes 对账结果中的问题
+func scanNotes(e *CCDScanEntry) (notes []string) {
+	if e.Orphan {
+		notes = append(notes, "没有ldap用户(机器账号可能是因为没有设置mail字段)")
+	}
+	if e.Disabled {
+		notes = append(notes, "AD账户已禁用")
+	}
+	if e.Expired {
+		notes = append(notes, "AD账户已过期")
+	}
+	if e.CCDDisabled {
+		notes = append(notes, "ccd已禁用")
+	}
+	if e.DuplicateVip {
+		notes = append(notes, "VIP重复")
+	}
+	if e.Quarantined != "" {
+		notes = append(notes, "已隔离到"+e.Quarantined)
+	}
+	if e.Error != "" {
+		notes = append(notes, e.Error)
+	}
+	return
+}
+
+func cmdSyncDisabled(args []string) error {
+	fs, path := newFlagSet("sync-disabled")
+	instance := fs.String("instance", "", "只同步该实例 为空时同步全部实例")
+	fs.Parse(args)
+	if err := setup(*path, true); err != nil {
+		return err
+	}
+	insts, err := selectInstances(*instance)
+	if err != nil {
+		return err
+	}
+	changes, err := SyncDisabled(insts)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "实例\t账号\t操作\t原因")
+	for _, c := range changes {
+		action := "启用"
+		if c.Disabled {
+			action = "禁用"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Instance, c.Sam, action, c.Reason)
+	}
+	return w.Flush()
+}
+
+func cmdSweepExpired(args []string) error {
+	fs, path := newFlagSet("sweep-expired")
+	format := fs.String("format", "text", "输出格式 text/json")
+	fs.Parse(args)
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("不支持的输出格式: %s", *format)
+	}
+	if err := setup(*path, false); err != nil {
+		return err
+	}
+	expired, err := SweepExpired()
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		if expired == nil {
+			expired = []*ExpiredRoute{}
+		}
+		return printJSON(expired)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "实例\t账号\t路由")
+	for _, e := range expired {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", e.Instance, e.Sam, e.Route)
+	}
+	return w.Flush()
+}
+
+func cmdCreateUser(args []string) error {
+	fs, path := newFlagSet("create-user")
+	instance := fs.String("instance", "", "OpenVPN 实例 为空时为默认实例")
+	sam := fs.String("sam", "", "账号名 为空时按工号与姓名查询ldap")
+	eid := fs.String("eid", "", "工号")
+	name := fs.String("name", "", "姓名")
+	fs.Parse(args)
+	if err := setup(*path, *sam == ""); err != nil {
+		return err
+	}
+	inst, err := GetInstance(*instance)
+	if err != nil {
+		return err
+	}
+
+	if *sam == "" {
+		res, err := fetchUser(&uuap.LdapConns, &uuap.LdapAttributes{Num: *eid, DisplayName: *name})
+		if err != nil {
+			return err
+		}
+		if res == nil {
+			return fmt.Errorf("查无此人: 工号[%s] 姓名[%s]", *eid, *name)
+		}
+		*sam = res.GetAttributeValue("sAMAccountName")
+	}
+	if !validSam(*sam) {
+		return fmt.Errorf("账号名不合法: %q", *sam)
+	}
+	if utils.IsFileExist(inst.CCDFilePath(*sam)) {
+		return fmt.Errorf("实例[%s]中已有账号[%s]的ccd文件", inst.Name, *sam)
+	}
+	if err = GenerateCCD4User(inst, *sam); err != nil {
+		return err
+	}
+	user, err := LoadUserCCD(inst, *sam)
+	if err != nil {
+		return err
+	}
+	recordAudit(&audit.Record{Action: audit.ActionCreate, Source: SourceCLI, Instance: inst.Name, Sam: *sam, Vip: user.Vip, After: user.Routes})
+	return printJSON(user)
+}
+
+func cmdShowUser(args []string) error {
+	fs, path := newFlagSet("show-user")
+	instance := fs.String("instance", "", "OpenVPN 实例 为空时为默认实例")
+	sam := fs.String("sam", "", "账号名")
+	fs.Parse(args)
+	if err := setup(*path, false); err != nil {
+		return err
+	}
+	inst, err := GetInstance(*instance)
+	if err != nil {
+		return err
+	}
+	user, err := LoadUserCCD(inst, *sam)
+	if err == errNotFound {
+		return fmt.Errorf("实例[%s]中没有账号[%s]的ccd文件", inst.Name, *sam)
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(user)
+}
+
+func cmdDeleteUser(args []string) error {
+	fs, path := newFlagSet("delete-user")
+	instance := fs.String("instance", "", "OpenVPN 实例 为空时为默认实例")
+	sam := fs.String("sam", "", "账号名")
+	fs.Parse(args)
+	if err := setup(*path, false); err != nil {
+		return err
+	}
+	inst, err := GetInstance(*instance)
+	if err != nil {
+		return err
+	}
+	user, err := RemoveCCD4User(inst, *sam, SourceCLI)
+	if err == errNotFound {
+		return fmt.Errorf("实例[%s]中没有账号[%s]的ccd文件", inst.Name, *sam)
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(user)
+}
+
+// cmdOrder 授权或回收 与MQ工单走同一处理流程
+func cmdOrder(operation string) func(args []string) error {
+	return func(args []string) error {
+		var ips stringsFlag
+		fs, path := newFlagSet(operation)
+		instance := fs.String("instance", "", "OpenVPN 实例 为空时为默认实例")
+		spName := fs.String("sp", "命令行", "工单名")
+		eid := fs.String("eid", "", "工号")
+		name := fs.String("name", "", "姓名")
+		fs.Var(&ips, "ip", "目标IP、CIDR或域名 可重复指定")
+		expire := fs.Duration("expire", 0, "权限有效期 如 720h 为0表示永久有效 仅授权时有效")
+		fs.Parse(args)
+		if len(ips) == 0 {
+			return errors.New("至少指定一个 -ip")
+		}
+		if err := setup(*path, true); err != nil {
+			return err
+		}
+
+		order := &schema.UVPNAuthority{
+			Version:     schema.Version,
+			SpName:      *spName,
+			Userid:      *eid,
+			Eid:         *eid,
+			DisplayName: *name,
+			Operation:   operation,
+			Instance:    *instance,
+		}
+		var expireAt int64
+		if *expire > 0 {
+			expireAt = time.Now().Add(*expire).Unix()
+		}
+		for _, ip := range ips {
+			order.UVPNDestIps = append(order.UVPNDestIps, schema.UVPNDestIp{DestIp: ip, ExpireAt: expireAt})
+		}
+
+		result, err := ApplyOrder(order, SourceCLI, "")
+		result.SetError(err)
+		if perr := printJSON(result); perr != nil {
+			return perr
+		}
+		return err
+	}
+}
+
+func cmdVipLookup(args []string) error {
+	fs, path := newFlagSet("vip-lookup")
+	instance := fs.String("instance", "", "OpenVPN 实例 为空时查询VIP池包含该VIP的全部实例")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: vip-lookup [参数] <VIP>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := setup(*path, false); err != nil {
+		return err
+	}
+	owners, err := LookupVip(*instance, fs.Arg(0))
+	if err == errNotFound {
+		return fmt.Errorf("没有实例的VIP池包含[%s]", fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(owners)
+}
+
+func cmdSessions(args []string) error {
+	fs, path := newFlagSet("sessions")
+	instance := fs.String("instance", "", "只查看该实例 为空时查看全部实例")
+	statusFile := fs.String("status-file", "", "解析该状态文件 而不是实例配置的管理接口或状态文件 需指定实例")
+	format := fs.String("format", "text", "输出格式 text/json")
+	fs.Parse(args)
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("不支持的输出格式: %s", *format)
+	}
+	if err := setup(*path, false); err != nil {
+		return err
+	}
+	insts, err := selectInstances(*instance)
+	if err != nil {
+		return err
+	}
+	if *statusFile != "" && len(insts) > 1 {
+		return errors.New("指定 -status-file 时需同时指定 -instance")
+	}
+
+	entries := []*SessionEntry{}
+	for _, inst := range insts {
+		instEntries, err := ListSessions(inst, *statusFile)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, instEntries...)
+	}
+	if *format == "json" {
+		return printJSON(entries)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "实例\t账号\t真实地址\t虚拟地址\t连接时间\t接收\t发送\t备注")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\n", e.Instance, e.CommonName, e.RealAddress, e.VirtualAddress,
+			e.ConnectedSince.Format("2006-01-02 15:04:05"), e.BytesReceived, e.BytesSent, strings.Join(sessionNotes(e), " "))
+	}
+	return w.Flush()
+}
+
+// sessionNotes 在线会话的问题
+func sessionNotes(e *SessionEntry) (notes []string) {
+	if e.NoCCD {
+		notes = append(notes, "没有ccd文件")
+	}
+	if e.CCDDisabled {
+		notes = append(notes, "ccd已禁用")
+	}
+	if e.VipMismatch {
+		notes = append(notes, fmt.Sprintf("VIP不一致(ccd文件[%s] 使用者[%s])", e.CCDVip, e.VipOwner))
+	}
+	if e.Error != "" {
+		notes = append(notes, e.Error)
+	}
+	return
+}
+
+func cmdMigrate(args []string) error {
+	fs, path := newFlagSet("migrate")
+	instance := fs.String("instance", "", "只迁移该实例 为空时迁移全部实例")
+	dryRun := fs.Bool("dry-run", false, "只报告不修改")
+	fs.Parse(args)
+	if err := setup(*path, false); err != nil {
+		return err
+	}
+	insts, err := selectInstances(*instance)
+	if err != nil {
+		return err
+	}
+
+	var reports []*MigrateReport
+	for _, inst := range insts {
+		report, err := MigrateInstance(inst, *dryRun)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, report)
+	}
+	return printJSON(reports)
+}
+
+func cmdFirewall(args []string) error {
+	fs, path := newFlagSet("firewall")
+	dryRun := fs.Bool("dry-run", false, "只输出规则集 不应用")
+	fs.Parse(args)
+	if err := setup(*path, false); err != nil {
+		return err
+	}
+	ruleset, err := BuildRuleset()
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		_, err = os.Stdout.Write(ruleset)
+		return err
+	}
+	return firewall.Apply(conf.Conf.Firewall.Nft, ruleset)
+}
+
+func cmdAudit(args []string) error {
+	fs, path := newFlagSet("audit")
+	filter := &audit.Filter{}
+	fs.StringVar(&filter.Instance, "instance", "", "只查询该实例")
+	fs.StringVar(&filter.Sam, "sam", "", "只查询该账号")
+	fs.StringVar(&filter.Dest, "dest", "", "只查询变更前后的路由包含该目标IP或CIDR的记录")
+	since := fs.Duration("since", 0, "只查询最近一段时间 如 720h 为0时不限制")
+	fs.IntVar(&filter.Limit, "limit", 100, "只输出最近的记录数 为0时不限制")
+	format := fs.String("format", "text", "输出格式 text/json")
+	fs.Parse(args)
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("不支持的输出格式: %s", *format)
+	}
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	if *since > 0 {
+		filter.Since = time.Now().Add(-*since)
+	}
+	if err := setup(*path, false); err != nil {
+		return err
+	}
+	if auditStore == nil {
+		return errors.New("未启用审计记录")
+	}
+
+	records, err := auditStore.Query(filter)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		return printJSON(records)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "时间\t操作\t来源\t实例\t账号\tVIP\t工单名\t用户id\t变更")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Time.Format("2006-01-02 15:04:05"), r.Action, r.Source,
+			r.Instance, r.Sam, r.Vip, r.SpName, r.Userid, strings.Join(auditChanges(r), ", "))
+	}
+	return w.Flush()
+}
+
+// auditChanges 审计记录中新增(+)与删除(-)的路由 以及附加说明
+func auditChanges(r *audit.Record) (changes []string) {
+	added, removed := r.Diff()
+	for _, route := range added {
+		changes = append(changes, "+"+route)
+	}
+	for _, route := range removed {
+		changes = append(changes, "-"+route)
+	}
+	if r.Detail != "" {
+		changes = append(changes, r.Detail)
+	}
+	return
+}
+
+// planEntry plan 子命令的json输出
+type planEntry struct {
+	Line   int         `json:"line"`
+	Result *UVPNResult `json:"result"`
+	Change *CCDChange  `json:"change,omitempty"`
+}
+
+func cmdPlan(args []string) error {
+	fs, path := newFlagSet("plan")
+	file := fs.String("file", "", "工单文件(JSON Lines) 为空时从标准输入读取")
+	format := fs.String("format", "text", "输出格式 text/json")
+	fs.Parse(args)
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("不支持的输出格式: %s", *format)
+	}
+	in := os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	if err := setup(*path, true); err != nil {
+		return err
+	}
+
+	// 同一个 Planner 依次计算 后面的工单基于前面工单修改后的内容
+	planner := NewPlanner()
+	entries := []*planEntry{}
+	scanner := bufio.NewScanner(in)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		entry := &planEntry{Line: lineNo}
+		order, err := schema.Decode([]byte(line))
+		if err != nil {
+			entry.Result = &UVPNResult{}
+		} else {
+			entry.Result, entry.Change, err = planner.Plan(order, "")
+		}
+		entry.Result.SetError(err)
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		return printJSON(entries)
+	}
+	for _, e := range entries {
+		r := e.Result
+		fmt.Printf("# 第%d行 工单名[%s] 操作[%s] 实例[%s] 账号[%s]\n", e.Line, r.SpName, r.Operation, r.Instance, r.Sam)
+		switch {
+		case r.Error != "":
+			fmt.Printf("处理失败: %s\n", r.Error)
+		case e.Change == nil || e.Change.Diff == "":
+			fmt.Println("ccd文件无修改")
+		default:
+			fmt.Print(e.Change.Diff)
+		}
+		fmt.Println()
+	}
+	return nil
+}
@@ -1,108 +1,138 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
-	"github.com/apache/rocketmq-client-go/v2"
-	"github.com/apache/rocketmq-client-go/v2/consumer"
-	"github.com/apache/rocketmq-client-go/v2/primitive"
-	"github.com/go-ldap/ldap/v3"
 	log "github.com/sirupsen/logrus"
-	"io/ioutil"
+	"mq/audit"
 	"mq/cache"
-	"mq/conf"
-	"mq/logger"
+	"mq/ccd"
 	"mq/ovpn"
+	"mq/schema"
+	"mq/transport"
 	"mq/utils"
 	"mq/uuap"
-	"net"
 	"os"
-	"strconv"
-	"sync"
-	"time"
 )
 
+// 查询LDAP用户 测试时替换
 var (
-	RouterTmp = `push "route %s %s"` // ccd添加路由规则模版
-	lock      sync.Mutex
+	fetchUser      = uuap.FetchUser
+	fetchLdapUsers = uuap.FetchLdapUsers
 )
 
 const (
 	InfoGenerateCCDFile4User = "无此用户ccd文件，为用户创建ccd文件并分配初始权限"
+	InfoRevokeWithoutCCDFile = "无此用户ccd文件，无需回收权限"
 )
 
-type UVPNAuthority struct {
-	SpName      string       `mapstructure:"spName"`
-	Userid      string       `mapstructure:"userid"`
-	Eid         string       `mapstructure:"工号"`
-	DisplayName string       `mapstructure:"姓名"`
-	UVPNDestIps []UVPNDestIp `mapstructure:"UVPN权限"`
+func Consumer() {
+	runConsumer("uvpn", ConsumeUVPN)
 }
 
-// UVPNDestIp UVPN目标权限
-type UVPNDestIp struct {
-	DestIp string `mapstructure:"目标IP"`
+// PlanConsumer 计划模式的消费者 只记录工单将对ccd文件做的修改 不写入也不回复
+func PlanConsumer() {
+	runConsumer(PlanGroup, PlanUVPN)
 }
 
-func Consumer() {
-	c, _ := rocketmq.NewPushConsumer(
-		consumer.WithGroupName("uvpn"),
-		consumer.WithNsResolver(primitive.NewPassthroughResolver([]string{conf.Conf.RocketMQ.Addr + ":" + conf.Conf.RocketMQ.Port})),
-	)
-
-	// 设置订阅消息的tag
-	selector := consumer.MessageSelector{
-		Type:       consumer.TAG,
-		Expression: conf.Conf.RocketMQ.TopicName, // 根据topic名称定义筛选表达式
+// runConsumer 以指定消费组和处理函数消费工单主题
+func runConsumer(group string, handler transport.Handler) {
+	t, err := NewTransport(group, false)
+	if err != nil {
+		log.Error("Fail to create transport, err: ", err)
+		os.Exit(-1)
 	}
+	mqTransport = t
 
-	err := c.Subscribe(conf.Conf.RocketMQ.TopicName, selector, func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
-		for i := range msgs {
-			err := HandleUVPN(msgs[i])
-			if err != nil {
-				log.Error(err)
-			}
-
-		}
-
-		return consumer.ConsumeSuccess, nil
-	})
-	if err != nil {
+	if err = subscribeUVPN(t, handler); err != nil {
 		log.Info(err.Error())
 	}
 
 	//开始消费
-	err = c.Start()
+	err = t.Start()
 	if err != nil {
 		log.Info(err.Error())
 		os.Exit(-1)
 
 	}
 
+	// 本地开发时从标准输入读取工单
+	if TransportDriver() == TransportMemory {
+		go func() {
+			if err := FeedOrders(os.Stdin, t); err != nil {
+				log.Error("Fail to read orders, err: ", err)
+			}
+		}()
+	}
+
 	// 同步阻塞
 	chWait := make(chan struct{})
 	<-chWait
 
-	err = c.Shutdown()
+	err = t.Shutdown()
 	if err != nil {
-		log.Info("shutdown Consumer error: %s", err.Error())
+		log.Infof("shutdown Consumer error: %s", err.Error())
 	}
 }
 
-// HandleUVPN 处理权限文件
-func HandleUVPN(msg *primitive.MessageExt) (err error) {
-	var order UVPNAuthority
-	json.Unmarshal(msg.Body, &order)
+// HandleUVPN 处理工单消息 返回的处理结果总不为nil
+func HandleUVPN(msg *transport.Message) (result *UVPNResult, err error) {
+	order, err := schema.Decode(msg.Body)
+	if err != nil {
+		return &UVPNResult{MsgId: msg.Id}, Permanent(ReasonBadMessage, err)
+	}
 
-	log.Info(fmt.Sprintf("[1]MQ消息: 主题[%s] 工单名[%s] 消息Id[%s] OffsetMsgId[%s] 存储时间[%s]",
-		msg.Topic, order.SpName, msg.MsgId, msg.OffsetMsgId,
-		time.Unix(msg.StoreTimestamp/1000, 0).Format("2006-01-02 15:04:05")))
+	log.Info(fmt.Sprintf("[1]MQ消息: 主题[%s] 工单名[%s] 操作[%s] 实例[%s] 消息Id[%s] 存储时间[%s]",
+		msg.Topic, order.SpName, order.Operation, order.Instance, msg.Id,
+		msg.StoredAt.Format("2006-01-02 15:04:05")))
 	fmt.Println("################################")
+
+	return ApplyOrder(order, SourceMQ, msg.Id)
+}
+
+// ApplyOrder 按工单修改用户的ccd文件 MQ工单与管理接口共用 返回的处理结果总不为nil
+func ApplyOrder(order *schema.UVPNAuthority, source, msgId string) (*UVPNResult, error) {
+	return applyOrder(order, source, msgId, nil)
+}
+
+// applyOrder p 不为nil时为计划模式 查询LDAP、预估VIP并计算ccd文件的修改 但不写入ccd文件也不修改redis
+func applyOrder(order *schema.UVPNAuthority, source, msgId string, p *Planner) (result *UVPNResult, err error) {
+	result = &UVPNResult{SpName: order.SpName, MsgId: msgId, Userid: order.Userid, Operation: order.Operation}
+	inst, err := GetInstance(order.Instance)
+	if err != nil {
+		return result, Permanent(ReasonUnknownInstance, err)
+	}
+	result.Instance = inst.Name
+
+	// 校验工单 不合法的目标地址逐个记录到处理结果
+	dests, rejected, err := schema.ValidateOrder(order)
+	var resolveErr *schema.ResolveError
+	if errors.As(err, &resolveErr) {
+		// DNS 暂时不可用 稍后重试
+		return result, err
+	}
+	if err != nil {
+		return result, Permanent(ReasonInvalidOrder, err)
+	}
+	result.Rejected = rejected
+	for _, r := range rejected {
+		log.Warning(fmt.Sprintf("[校验]工单名[%s] 拒绝%s", order.SpName, r))
+	}
+	// 没有合法的目标地址 或替换全部路由时有不合法的目标地址 则整个工单失败
+	if len(rejected) > 0 && (len(dests) == 0 || order.Operation == schema.OperationReplace) {
+		return result, Permanent(ReasonBadDestination, fmt.Errorf("%d个目标地址不合法", len(rejected)))
+	}
+
+	// 将工单中的目标地址转换为ovpn的路由
+	var routes []ccd.Route
+	expires := map[string]int64{} // 路由对应的过期时间
+	for _, dest := range dests {
+		routes = append(routes, dest.Route)
+		expires[dest.Route.Key()] = dest.ExpireAt
+	}
+
 	// 查询LDAP用户，如果有这个人，则取其sam名称
-	res, err := uuap.FetchUser(&uuap.LdapConns, &uuap.LdapAttributes{
+	res, err := fetchUser(&uuap.LdapConns, &uuap.LdapAttributes{
 		Num:         order.Eid,
 		DisplayName: order.DisplayName,
 	})
@@ -115,184 +145,174 @@ func HandleUVPN(msg *primitive.MessageExt) (err error) {
 			Num:         order.Eid,
 			DisplayName: order.DisplayName,
 		})
-		return errors.New("查无此人！")
+		return result, Permanent(ReasonUserNotFound, fmt.Errorf("工号[%s] 姓名[%s]", order.Eid, order.DisplayName))
 	}
 
 	// 如果ldap用户存在 但ccd文件不存在，则到redis取最新的VIP
-	var ccdPath string
-	if conf.Conf.System.Dev {
-		ccdPath = conf.Conf.System.DevCCDFilePath
-	} else {
-		ccdPath = conf.Conf.System.CCDFilePath
+	sam := res.GetAttributeValue("sAMAccountName")
+	result.Sam = sam
+	ccdFilePath := inst.CCDFilePath(sam)
+	generate, update := GenerateCCD4User, ccd.Update
+	isUserCCDFileExist := utils.IsFileExist(ccdFilePath)
+	if p != nil {
+		generate, update = p.generate, p.update
+		isUserCCDFileExist = p.exists(ccdFilePath)
 	}
-	isUserCCDFileExist := utils.IsFileExist(ccdPath + "/" + res.GetAttributeValue("sAMAccountName"))
-	// 如果发现ccd文件不存在，则新建ccd文件并写入基础权限 加锁
 	if !isUserCCDFileExist {
-		err = GenerateCCD4User(ccdPath + "/" + res.GetAttributeValue("sAMAccountName"))
+		// 回收权限时无ccd文件则无需处理
+		if order.Operation == schema.OperationRevoke {
+			log.Info(InfoRevokeWithoutCCDFile)
+			result.Skipped = order.DestIps()
+			return
+		}
+		// 如果发现ccd文件不存在，则新建ccd文件并写入基础权限 加锁
+		err = generate(inst, sam)
 		if err != nil {
 			return
 		}
 		log.Info(InfoGenerateCCDFile4User)
 	}
-
-	// 将取到的LDAP名称同名的ovpn的ccd文件做修改
-	content := ""
-	for idx, cidr := range order.UVPNDestIps {
-		if idx == len(order.UVPNDestIps)-1 {
-			content += CIDR2OVPNRouterClause(cidr.DestIp)
-		} else {
-			content += CIDR2OVPNRouterClause(cidr.DestIp) + "\n"
+	record := &audit.Record{Source: source, MsgId: msgId, SpName: order.SpName, Userid: order.Userid, Instance: inst.Name, Sam: sam}
+
+	// 按操作类型修改LDAP名称同名的ovpn的ccd文件 已授权的路由不重复写入
+	var added, skipped, removed []ccd.Route
+	err = update(ccdFilePath, func(f *ccd.File) error {
+		record.Before = routeStrings(f.Routes())
+		switch order.Operation {
+		case schema.OperationRevoke:
+			removed, skipped = f.RemoveRoutes(routes)
+		case schema.OperationReplace:
+			added, removed = f.ReplaceRoutes(routes)
+		default:
+			added, skipped = f.MergeRoutes(routes)
 		}
-
-	}
-	// 将权限更新到配置文件
-	err = utils.AddRoute4User(ccdPath+"/"+res.GetAttributeValue("sAMAccountName"), content)
+		result.Vip = f.VIP()
+		record.After = routeStrings(f.Routes())
+		return nil
+	})
 	if err != nil {
 		return
 	} else {
+		result.Added, result.Skipped, result.Removed = routeStrings(added), routeStrings(skipped), routeStrings(removed)
 		log.Info(fmt.Sprintf("[2]用户[%s] 账号[%s]", res.GetAttributeValue("displayName"), res.GetAttributeValue("sAMAccountName")))
-		log.Info(fmt.Sprintf("[3]详细新增路由: %s", content))
+		log.Info(fmt.Sprintf("[3]详细新增路由: %v", added))
+		if len(removed) > 0 {
+			log.Info(fmt.Sprintf("[4]详细回收路由: %v", removed))
+		}
+		if len(skipped) > 0 {
+			if order.Operation == schema.OperationRevoke {
+				log.Info(fmt.Sprintf("[5]未授权跳过路由: %v", skipped))
+			} else {
+				log.Info(fmt.Sprintf("[5]已授权跳过路由: %v", skipped))
+			}
+		}
 	}
-	return
-}
-
-// GenerateCCD4User 为用户生成ccd文件
-func GenerateCCD4User(ccdFilePath string) (err error) {
-	// 获取ovpn当前可分配vip对应的int值
-	lock.Lock()
-	currentVip, err := cache.Get("OVPNVIP")
-	if err != nil {
-		lock.Unlock()
+	// 计划模式到此为止
+	if p != nil {
 		return
 	}
-	lock.Unlock()
-
-	temp, err := cache.Get("OVPNTEMP")
-	if err != nil {
-		return
+	// 记录审计 新建的ccd文件先记录一条新建
+	record.Vip = result.Vip
+	if !isUserCCDFileExist {
+		recordAudit(&audit.Record{Action: audit.ActionCreate, Source: source, MsgId: msgId, SpName: order.SpName,
+			Userid: order.Userid, Instance: inst.Name, Sam: sam, Vip: result.Vip, After: record.Before})
 	}
-
-	num, err := strconv.ParseUint(currentVip, 10, 32)
-	if err != nil {
-		return
+	if len(added) > 0 || len(removed) > 0 {
+		record.Action = order.Operation
+		recordAudit(record)
 	}
-
-	vip, err := ovpn.NumToVip(uint32(num))
-	if err != nil {
-		return
+	if !isUserCCDFileExist || len(added) > 0 || len(removed) > 0 {
+		RequestFirewallSync()
 	}
-
-	err = utils.GenerateCCD(ccdFilePath, fmt.Sprintf(temp, vip))
-	if err != nil {
-		return
+	// 修改ccd文件只在用户下次连接时生效 回收了路由时断开用户的在线会话
+	// 要在记录过期时间之前 记录失败重试时路由已不在ccd文件中 不会再断开
+	if len(removed) > 0 {
+		result.Killed = KillSessions(inst, sam, "回收路由")
 	}
-
-	// 成功生成ccd文件后，刷新缓存中的当前vip
-	err = AddVip(currentVip)
-	if err != nil { // 如果更新缓存的vip失败，则删除ccd文件
-		err = os.Remove(ccdFilePath)
+	// 记录限时权限的过期时间
+	if err = UpdateExpiry(inst, sam, order.Operation, routes, expires, added, removed); err != nil {
 		return
 	}
 	return
 }
 
-// AddVip 为用户生成ccd文件成功后，缓存中的vip加1
-func AddVip(oldVipStr string) (err error) {
-	oldVip, err := strconv.Atoi(oldVipStr)
-	if err != nil {
-		return err
+// userTemplate 实例的新用户ccd文件模版 %s 为VIP 实例未配置时使用redis中的 OVPNTEMP
+func userTemplate(inst *ovpn.Instance) (string, error) {
+	if inst.Template != "" {
+		return inst.Template, nil
 	}
-	lock.Lock()
-	err = cache.Set("OVPNVIP", strconv.Itoa(oldVip+1))
+	return cache.Get("OVPNTEMP")
+}
+
+// GenerateCCD4User 在实例中为用户生成ccd文件
+func GenerateCCD4User(inst *ovpn.Instance, sam string) (err error) {
+	temp, err := userTemplate(inst)
 	if err != nil {
-		lock.Unlock()
 		return
 	}
-	lock.Unlock()
-	return
-}
 
-// CIDR2OVPNRouterClause CIDR2OVPNRouter 将mq中的地址转换为ovpn的路由语句
-func CIDR2OVPNRouterClause(src string) (res string) {
-	dnsIp, err := utils.ResolveIP(src) // 将域名解析
+	// 分配vip 优先复用已回收的vip 多个消费者共用redis时不会分到同一个vip
+	vip, err := inst.Allocator.Allocate(sam)
 	if err != nil {
-		// 如果是CIDR则生成子网掩码
-		_, ipv4Net, _ := net.ParseCIDR(src)
-		res += fmt.Sprintf(RouterTmp, ipv4Net.IP, utils.Ipv4MaskString(ipv4Net.Mask))
-	} else {
-		res += fmt.Sprintf(RouterTmp, dnsIp, "255.255.255.255")
+		return
 	}
-	return
-}
 
-// ScanUVPNUserCCD 扫描所有ldap用户，去匹配ccd文件，不存在对应用户的ccd就可以删掉了--删除操作尽量手动删除 防止放在循环中因为意外清理掉了所有用户文件
-func ScanUVPNUserCCD() {
-	fmt.Println("##################")
-	var ldapUserKeys []interface{} // ldap用户 账号名
-	var ldapUser = map[string]*ldap.Entry{}
-	users := uuap.FetchLdapUsers(&uuap.LdapAttributes{})
-	for _, user := range users {
-		ldapUserKeys = append(ldapUserKeys, user.GetAttributeValue("sAMAccountName"))
-		ldapUser[user.GetAttributeValue("sAMAccountName")] = user
+	created, path := false, inst.CCDFilePath(sam)
+	err = ccd.Update(path, func(f *ccd.File) error {
+		// 其他消费者已为该用户生成了ccd文件
+		if len(f.Lines) > 0 {
+			return nil
+		}
+		*f = *ccd.ParseString(fmt.Sprintf(temp, vip))
+		created = true
+		return nil
+	})
+	// 写入失败时以磁盘上的ccd文件为准 重命名后目录落盘失败时文件已使用该vip
+	if err != nil && created {
+		f, loadErr := ccd.Load(path)
+		created = loadErr == nil && f.VIP() == vip
 	}
-
-	count := 0
-	count2 := 0
-	rd, _ := ioutil.ReadDir(conf.Conf.System.DevCCDFilePath)
-	for _, file := range rd {
-		// ccd文件存在ldap用户账号名映射的 保留
-		if utils.IsInSlice(file.Name(), ldapUserKeys) {
-			count++
-			firstLine, err := utils.ExtractViPFromCCD(conf.Conf.System.DevCCDFilePath + "/" + file.Name())
-			if err != nil {
-				fmt.Println(err)
-			}
-			fmt.Println(count, ldapUser[file.Name()].GetAttributeValue("employeeNumber"), file.Name(), ldapUser[file.Name()].GetAttributeValue("displayName"), firstLine)
-
-		} else { // ccd文件名不存在ldap用户账号名映射的 报告出来，手动处理
-			count2++
-			fmt.Println("+++++++++++++ccd文件没有ldap用户映射的有：", count2, file.Name(), "如果是机器账号可能是因为没有设置mail字段，在查询时被过滤掉了+++++++++++++++++")
+	// 未使用分配到的vip则放回空闲列表
+	if !created {
+		if releaseErr := inst.Allocator.Release(vip); releaseErr != nil {
+			log.Error("Fail to release vip, err: ", releaseErr)
 		}
-
 	}
-
+	return
 }
 
-func main() {
-	path := flag.String("config", "", "指定配置文件地址")
-	flag.Parse()
-	conf.ConfPath = *path
-	conf.Conf, _ = conf.Init(conf.ConfPath)
-
-	if conf.Conf.System.CCDFilePath == "" {
-		panic("uvpn ccd 路径不可为空！")
+// RemoveCCD4User 删除实例中用户的ccd文件并回收其vip 断开用户的在线会话
+// VIP的使用者不是该用户(如VIP重复)时只删除文件 不回收VIP
+func RemoveCCD4User(inst *ovpn.Instance, sam, source string) (user *UserCCD, err error) {
+	if !validSam(sam) {
+		return nil, fmt.Errorf("账号名不合法: %q", sam)
 	}
-	if conf.Conf.LdapCfg.ConnUrl == "" || conf.Conf.LdapCfg.AdminAccount == "" || conf.Conf.LdapCfg.BaseDn == "" {
-		panic("LDAP连接信息不可以为空！")
+	f, err := ccd.Remove(inst.CCDFilePath(sam))
+	if os.IsNotExist(err) {
+		return nil, errNotFound
 	}
-
-	// 初始化日志
-	logger.Init()
-
-	// 初始化LDAP连接池
-	if err := uuap.Init(conf.Conf); err != nil {
-		panic(err)
+	if err != nil {
+		return
 	}
-
-	// 初始化缓存
-	if err := cache.Init(&conf.Conf.Redis); err != nil {
-		panic(err)
+	user = newUserCCD(inst, sam, f)
+	RequestFirewallSync()
+	recordAudit(&audit.Record{Action: audit.ActionDelete, Source: source, Instance: inst.Name, Sam: sam, Vip: user.Vip, Before: user.Routes})
+	KillSessions(inst, sam, "删除用户")
+	if user.Vip == "" {
+		return
 	}
 
-	//ScanUVPNUserCCD()
-
-	// 消费者
-	Consumer()
-
-	//ScanUVPNUserCCD()
-	//err := GenerateCCD4User(conf.Conf.System.DevCCDFilePath + "/" + "test")
-	//if err != nil {
-	//	log.Error(err)
-	//}
-
+	owner, err := inst.Allocator.Owner(user.Vip)
+	if err != nil {
+		return
+	}
+	if owner != sam {
+		log.Warning(fmt.Sprintf("[回收VIP]实例[%s] 账号[%s] VIP[%s]的使用者为[%s] 不回收", inst.Name, sam, user.Vip, owner))
+		return
+	}
+	if err = inst.Allocator.Release(user.Vip); err != nil {
+		return
+	}
+	log.Info(fmt.Sprintf("[回收VIP]实例[%s] 账号[%s] VIP[%s]", inst.Name, sam, user.Vip))
+	return
 }
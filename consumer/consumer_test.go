@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-ldap/ldap/v3"
+	"io/ioutil"
+	"mq/audit"
+	"mq/cache"
+	"mq/conf"
+	"mq/mgmt"
+	"mq/ovpn"
+	"mq/schema"
+	"mq/transport"
+	"mq/uuap"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setupConsumer 以内存传输、miniredis 与临时ccd目录初始化消费者 ldapErrors 为查询LDAP前几次返回的错误次数
+func setupConsumer(t *testing.T, ldapErrors int32) (*transport.Memory, string) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	if err = cache.Init(&cache.Config{Addr: mr.Addr()}); err != nil {
+		t.Fatal(err)
+	}
+	mr.Set("OVPNTEMP", "ifconfig-push %s 255.255.0.0\n")
+
+	dir := t.TempDir()
+	conf.Conf = &uuap.Config{Transport: TransportMemory}
+	conf.Conf.System.CCDFilePath = dir
+	conf.Conf.VipPool = ovpn.PoolConfig{CIDR: "10.11.0.0/16"}
+	conf.Conf.RocketMQ.TopicName = "UVPN"
+	conf.Conf.RocketMQ.ReplyTopic = "UVPN_RESULT"
+	conf.Conf.RocketMQ.MaxRetries = 2
+	if err = InitInstances(conf.Conf); err != nil {
+		t.Fatal(err)
+	}
+	// 审计文件不能放在ccd目录内
+	conf.Conf.Audit.Path = filepath.Join(t.TempDir(), "audit.jsonl")
+	if err = InitAudit(conf.Conf); err != nil {
+		t.Fatal(err)
+	}
+
+	// 工号1001为张三 其他工号查无此人
+	var calls int32
+	fetchUser = func(ctx *uuap.LdapConn, user *uuap.LdapAttributes) (*ldap.Entry, error) {
+		if atomic.AddInt32(&calls, 1) <= ldapErrors {
+			return nil, errors.New("ldap unavailable")
+		}
+		if user.Num != "1001" {
+			return nil, nil
+		}
+		return ldap.NewEntry("CN=张三,DC=x,DC=com", map[string][]string{
+			"sAMAccountName": {"zhangsan"},
+			"displayName":    {"张三"},
+		}), nil
+	}
+	t.Cleanup(func() { fetchUser = uuap.FetchUser })
+
+	tp, err := NewTransport("uvpn", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := tp.(*transport.Memory)
+	m.RetryDelay = time.Millisecond
+	mqTransport = m
+	if err = SubscribeUVPN(m); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Shutdown() })
+	return m, dir
+}
+
+// writeCCDFiles 在ccd目录下写入ccd文件 文件名 -> 内容
+func writeCCDFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// publishOrder 发布工单并等待处理完毕
+func publishOrder(t *testing.T, m *transport.Memory, order *schema.UVPNAuthority) {
+	data, err := schema.Encode(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Publish(context.Background(), &transport.Message{Topic: "UVPN", Tag: "UVPN", Body: data}); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Drain(5 * time.Second) {
+		t.Fatal("Drain timeout")
+	}
+}
+
+// results 回复主题中的处理结果
+func results(t *testing.T, m *transport.Memory) (res []*UVPNResult) {
+	for _, msg := range m.Published("UVPN_RESULT") {
+		var r UVPNResult
+		if err := json.Unmarshal(msg.Body, &r); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, &r)
+	}
+	return
+}
+
+// 授权时为新用户生成ccd文件并回复处理结果
+func TestConsumeGrant(t *testing.T) {
+	m, dir := setupConsumer(t, 0)
+	publishOrder(t, m, &schema.UVPNAuthority{
+		SpName: "SP-1", Eid: "1001", DisplayName: "张三",
+		UVPNDestIps: []schema.UVPNDestIp{{DestIp: "10.16.3.0/24"}, {DestIp: "192.168.5.9"}, {DestIp: "8.8.8.8"}},
+	})
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "zhangsan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"ifconfig-push 10.11.0.2 255.255.0.0", `push "route 10.16.3.0 255.255.255.0"`, `push "route 192.168.5.9 255.255.255.255"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("ccd file missing %q:\n%s", want, data)
+		}
+	}
+
+	res := results(t, m)
+	if len(res) != 1 {
+		t.Fatalf("got %d results", len(res))
+	}
+	if r := res[0]; !r.Success || r.Sam != "zhangsan" || r.Vip != "10.11.0.2" || len(r.Added) != 2 || len(r.Rejected) != 1 || r.Rejected[0].Value != "8.8.8.8" {
+		t.Errorf("result = %+v", r)
+	}
+	if dlq := m.Published(DLQTopic()); len(dlq) != 0 {
+		t.Errorf("unexpected DLQ messages: %d", len(dlq))
+	}
+
+	// 回收 断开用户的在线会话
+	server, err := mgmt.NewFakeServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.Connect("zhangsan")
+	DefaultInstance.Mgmt = mgmt.NewClient(&mgmt.Config{Addr: server.Addr()})
+	publishOrder(t, m, &schema.UVPNAuthority{
+		SpName: "SP-2", Eid: "1001", DisplayName: "张三", Operation: schema.OperationRevoke,
+		UVPNDestIps: []schema.UVPNDestIp{{DestIp: "192.168.5.9"}},
+	})
+	if r := results(t, m)[1]; !r.Success || len(r.Removed) != 1 || r.Vip != "10.11.0.2" || r.Killed != 1 {
+		t.Errorf("revoke result = %+v", r)
+	}
+	if killed := server.Killed(); len(killed) != 1 || killed[0] != "zhangsan" {
+		t.Errorf("killed = %v", killed)
+	}
+
+	// 审计记录 新建、授权、回收
+	records, err := auditStore.Query(&audit.Filter{Sam: "zhangsan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("audit records = %+v", records)
+	}
+	if r := records[0]; r.Action != audit.ActionCreate || r.Vip != "10.11.0.2" || r.Source != SourceMQ {
+		t.Errorf("create record = %+v", r)
+	}
+	if r := records[1]; r.Action != schema.OperationGrant || r.SpName != "SP-1" || r.MsgId == "" || len(r.Before) != 0 || len(r.After) != 2 {
+		t.Errorf("grant record = %+v", r)
+	}
+	if r := records[2]; r.Action != schema.OperationRevoke || len(r.Before) != 2 || len(r.After) != 1 {
+		t.Errorf("revoke record = %+v", r)
+	}
+	if records, _ = auditStore.Query(&audit.Filter{Dest: "192.168.5.9"}); len(records) != 2 {
+		t.Errorf("dest records = %+v", records)
+	}
+}
+
+// 记录过期时间失败时也已断开在线会话 重试时路由已不在ccd文件中
+func TestRevokeKillsBeforeExpiry(t *testing.T) {
+	_, dir := setupConsumer(t, 0)
+	writeCCDFiles(t, dir, map[string]string{"zhangsan": "ifconfig-push 10.11.0.2 255.255.0.0\npush \"route 192.168.5.9 255.255.255.255\"\n"})
+	server, err := mgmt.NewFakeServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.Connect("zhangsan")
+	DefaultInstance.Mgmt = mgmt.NewClient(&mgmt.Config{Addr: server.Addr()})
+
+	// 过期时间的键类型错误时 ZREM 失败
+	if err = cache.Set(ExpireKey, "broken"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := ApplyOrder(&schema.UVPNAuthority{
+		SpName: "SP-2", Eid: "1001", DisplayName: "张三", Operation: schema.OperationRevoke,
+		UVPNDestIps: []schema.UVPNDestIp{{DestIp: "192.168.5.9"}},
+	}, SourceCLI, "")
+	if err == nil {
+		t.Fatal("记录过期时间失败时应返回错误")
+	}
+	if len(result.Removed) != 1 || result.Killed != 1 {
+		t.Errorf("result = %+v", result)
+	}
+	if killed := server.Killed(); len(killed) != 1 || killed[0] != "zhangsan" {
+		t.Errorf("killed = %v", killed)
+	}
+}
+
+// 查无此人等永久失败直接进入死信主题
+func TestConsumePermanentFailure(t *testing.T) {
+	m, _ := setupConsumer(t, 0)
+	publishOrder(t, m, &schema.UVPNAuthority{
+		SpName: "SP-3", Eid: "9999", DisplayName: "李四",
+		UVPNDestIps: []schema.UVPNDestIp{{DestIp: "10.16.3.1"}},
+	})
+
+	dlq := m.Published(DLQTopic())
+	if len(dlq) != 1 || !strings.HasPrefix(dlq[0].Property(PropertyDLQReason), ReasonUserNotFound) || dlq[0].Property(PropertyReconsumeTimes) != "0" {
+		t.Fatalf("DLQ = %+v", dlq)
+	}
+	if res := results(t, m); len(res) != 1 || res[0].Success || res[0].Error == "" {
+		t.Errorf("results = %+v", res)
+	}
+}
+
+// 暂时失败重试 超过最大重试次数后进入死信主题
+func TestConsumeRetry(t *testing.T) {
+	order := &schema.UVPNAuthority{
+		SpName: "SP-4", Eid: "1001", DisplayName: "张三",
+		UVPNDestIps: []schema.UVPNDestIp{{DestIp: "10.16.3.1"}},
+	}
+
+	m, _ := setupConsumer(t, 2)
+	publishOrder(t, m, order)
+	if res := results(t, m); len(res) != 1 || !res[0].Success {
+		t.Errorf("results = %+v", res)
+	}
+	if dlq := m.Published(DLQTopic()); len(dlq) != 0 {
+		t.Errorf("unexpected DLQ messages: %d", len(dlq))
+	}
+
+	m, _ = setupConsumer(t, 100)
+	publishOrder(t, m, order)
+	dlq := m.Published(DLQTopic())
+	if len(dlq) != 1 || dlq[0].Property(PropertyReconsumeTimes) != "2" {
+		t.Fatalf("DLQ = %+v", dlq)
+	}
+	if res := results(t, m); len(res) != 1 || res[0].Success {
+		t.Errorf("results = %+v", res)
+	}
+}
+
+// 写入ccd文件失败时分配到的VIP放回空闲列表 重试时不会再占用一个VIP
+func TestGenerateCCDFailureReleasesVip(t *testing.T) {
+	setupConsumer(t, 0)
+	inst := DefaultInstance
+	// 账号名过长时可以查询文件 但无法创建同目录下的临时文件 root 执行时也会失败
+	sam := strings.Repeat("a", 250)
+	if err := GenerateCCD4User(inst, sam); err == nil {
+		t.Fatal("写入ccd文件失败时应返回错误")
+	}
+	if owner, err := inst.Allocator.Owner("10.11.0.2"); err != nil || owner != "" {
+		t.Errorf("Owner(10.11.0.2) = %q, %v", owner, err)
+	}
+	if err := GenerateCCD4User(inst, "zhangsan"); err != nil {
+		t.Fatal(err)
+	}
+	if owner, _ := inst.Allocator.Owner("10.11.0.2"); owner != "zhangsan" {
+		t.Errorf("重试应复用放回的VIP: Owner(10.11.0.2) = %q", owner)
+	}
+}
+
+// 审计文件的相对路径与默认文件名以配置文件所在目录为准
+func TestAuditPath(t *testing.T) {
+	defer func(path string) { conf.ConfPath = path }(conf.ConfPath)
+	conf.ConfPath = "/opt/uvpn/conf.yaml"
+	for path, want := range map[string]string{
+		"":                    "/opt/uvpn/uvpn-audit.jsonl",
+		"audit/uvpn.jsonl":    "/opt/uvpn/audit/uvpn.jsonl",
+		"/var/log/uvpn.jsonl": "/var/log/uvpn.jsonl",
+	} {
+		if got, err := auditPath(path); err != nil || got != want {
+			t.Errorf("auditPath(%q) = %s, %v, want %s", path, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+	"mq/audit"
+	"mq/cache"
+	"mq/ccd"
+	"mq/ovpn"
+	"mq/uuap"
+	"os"
+	"time"
+)
+
+const (
+	// DisabledKey 因AD账户禁用或过期而写入 disable 的用户 集合 成员为 实例|账号
+	// 只有集合中的用户会在AD账户恢复后移除 disable 手动禁用的用户不受影响
+	DisabledKey = "OVPNDISABLED"
+	// DefaultDisableSyncInterval 默认按AD账户状态同步禁用的间隔
+	DefaultDisableSyncInterval = 10 * time.Minute
+)
+
+// DisableChange 一次禁用或启用
+type DisableChange struct {
+	Instance string `json:"instance"`
+	Sam      string `json:"sam"`
+	Disabled bool   `json:"disabled"` // true 为写入 disable; false 为移除 disable
+	Reason   string `json:"reason"`
+}
+
+// inactiveReason AD账户不可用的原因 可用时返回空字符串
+func inactiveReason(user *ldap.Entry, now time.Time) string {
+	switch {
+	case uuap.AccountDisabled(user):
+		return "AD账户已禁用"
+	case uuap.AccountExpired(user, now):
+		return "AD账户已过期"
+	}
+	return ""
+}
+
+// SyncDisabled 按AD账户状态禁用或启用实例中的用户
+// AD账户禁用或过期的用户写入 disable 指令; 由本任务禁用的用户在AD账户恢复后移除 disable 指令
+// 没有ccd文件或没有ldap用户的账号不处理
+func SyncDisabled(insts []*ovpn.Instance) (changes []*DisableChange, err error) {
+	users, err := fetchLdapUsers(&uuap.LdapAttributes{})
+	if err != nil {
+		return nil, err
+	}
+	// 查询成功但没有用户时多半是查询条件或权限有误 不做任何修改
+	if len(users) == 0 {
+		return nil, errors.New("未查询到LDAP用户")
+	}
+	now := time.Now()
+	for _, inst := range insts {
+		for _, user := range users {
+			sam := user.GetAttributeValue("sAMAccountName")
+			if !validSam(sam) {
+				continue
+			}
+			change, err := syncUserDisabled(inst, sam, inactiveReason(user, now))
+			if err != nil {
+				log.Error(fmt.Sprintf("[账户同步]实例[%s] 账号[%s] 同步失败: %v", inst.Name, sam, err))
+				continue
+			}
+			if change != nil {
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes, nil
+}
+
+// syncUserDisabled 按AD账户状态修改用户的ccd文件 reason 为空表示AD账户可用 没有修改时返回 nil
+func syncUserDisabled(inst *ovpn.Instance, sam, reason string) (*DisableChange, error) {
+	path := inst.CCDFilePath(sam)
+	f, err := ccd.Load(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	member := inst.Name + "|" + sam
+
+	if reason != "" {
+		// 已禁用(手动禁用或已由本任务禁用)的不再修改
+		if f.Disabled() {
+			return nil, nil
+		}
+		// 先记录为自动禁用再写入 disable 否则记录失败时用户会一直被禁用
+		if err = cache.SAdd(DisabledKey, member); err != nil {
+			return nil, err
+		}
+		if err = setCCDDisabled(path, true); err != nil {
+			if rerr := cache.SRem(DisabledKey, member); rerr != nil {
+				log.Error(fmt.Sprintf("[账户同步]实例[%s] 账号[%s] 撤销自动禁用记录失败: %v", inst.Name, sam, rerr))
+			}
+			return nil, err
+		}
+		log.Warning(fmt.Sprintf("[账户同步]实例[%s] 账号[%s] %s 已禁用VPN", inst.Name, sam, reason))
+		recordAudit(disableRecord(audit.ActionDisable, inst, sam, f, reason))
+		KillSessions(inst, sam, reason)
+		return &DisableChange{Instance: inst.Name, Sam: sam, Disabled: true, Reason: reason}, nil
+	}
+
+	managed, err := cache.SIsMember(DisabledKey, member)
+	if err != nil || !managed {
+		return nil, err
+	}
+	if f.Disabled() {
+		if err = setCCDDisabled(path, false); err != nil {
+			return nil, err
+		}
+	}
+	if err = cache.SRem(DisabledKey, member); err != nil {
+		return nil, err
+	}
+	reason = "AD账户已恢复"
+	log.Info(fmt.Sprintf("[账户同步]实例[%s] 账号[%s] %s 已启用VPN", inst.Name, sam, reason))
+	recordAudit(disableRecord(audit.ActionEnable, inst, sam, f, reason))
+	return &DisableChange{Instance: inst.Name, Sam: sam, Disabled: false, Reason: reason}, nil
+}
+
+// disableRecord 禁用或启用的审计记录 路由不变
+func disableRecord(action string, inst *ovpn.Instance, sam string, f *ccd.File, reason string) *audit.Record {
+	routes := routeStrings(f.Routes())
+	return &audit.Record{Action: action, Source: SourceAccountSync, Instance: inst.Name, Sam: sam,
+		Vip: f.VIP(), Before: routes, After: routes, Detail: reason}
+}
+
+// setCCDDisabled 写入或移除ccd文件中的 disable 指令
+func setCCDDisabled(path string, disabled bool) error {
+	err := ccd.Update(path, func(f *ccd.File) error {
+		f.SetDisabled(disabled)
+		return nil
+	})
+	if err == nil {
+		RequestFirewallSync()
+	}
+	return err
+}
+
+// StartDisableSync 后台定时按AD账户状态禁用或启用用户 interval 为负数时不启动
+func StartDisableSync(interval time.Duration) {
+	if interval < 0 {
+		log.Info("[账户同步]未启用")
+		return
+	}
+	if interval == 0 {
+		interval = DefaultDisableSyncInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := SyncDisabled(sortedInstances()); err != nil {
+				log.Error("[账户同步]同步失败: ", err)
+			}
+		}
+	}()
+}
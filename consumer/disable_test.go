@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-ldap/ldap/v3"
+	"mq/cache"
+	"mq/ccd"
+	"mq/ovpn"
+	"mq/uuap"
+	"path/filepath"
+	"testing"
+)
+
+// AD账户禁用或过期时写入 disable 恢复后只移除本任务写入的 disable
+func TestSyncDisabled(t *testing.T) {
+	_, dir := setupConsumer(t, 0)
+	files := map[string]string{
+		"zhangsan": "ifconfig-push 10.11.0.2 255.255.0.0\n",
+		"lisi":     "ifconfig-push 10.11.0.3 255.255.0.0\n",
+		"wangwu":   "ifconfig-push 10.11.0.4 255.255.0.0\n",
+		"zhaoliu":  "ifconfig-push 10.11.0.5 255.255.0.0\ndisable\n",
+		"robot":    "ifconfig-push 10.11.0.9 255.255.0.0\n",
+	}
+	writeCCDFiles(t, dir, files)
+	uac := map[string]string{"zhangsan": "512", "lisi": "514", "wangwu": "512", "zhaoliu": "512"}
+	fetchLdapUsers = func(user *uuap.LdapAttributes) ([]*ldap.Entry, error) {
+		expires := map[string]string{"wangwu": "132854400000000000"}
+		var entries []*ldap.Entry
+		for _, sam := range []string{"zhangsan", "lisi", "wangwu", "zhaoliu"} {
+			accountExpires := expires[sam]
+			if accountExpires == "" {
+				accountExpires = "0"
+			}
+			entries = append(entries, ldap.NewEntry("CN="+sam, map[string][]string{
+				"sAMAccountName": {sam}, "userAccountControl": {uac[sam]}, "accountExpires": {accountExpires},
+			}))
+		}
+		return entries, nil
+	}
+	defer func() { fetchLdapUsers = uuap.FetchLdapUsers }()
+
+	disabled := func(sam string) bool {
+		f, err := ccd.Load(filepath.Join(dir, sam))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f.Disabled()
+	}
+	insts := []*ovpn.Instance{DefaultInstance}
+
+	changes, err := SyncDisabled(insts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Sam != "lisi" || changes[1].Sam != "wangwu" || !changes[0].Disabled {
+		t.Fatalf("changes = %+v", changes)
+	}
+	for sam, want := range map[string]bool{"zhangsan": false, "lisi": true, "wangwu": true, "zhaoliu": true, "robot": false} {
+		if got := disabled(sam); got != want {
+			t.Errorf("%s disabled = %v, want %v", sam, got, want)
+		}
+	}
+	if managed, _ := cache.SIsMember(DisabledKey, "default|zhaoliu"); managed {
+		t.Error("手动禁用的用户不应记录为自动禁用")
+	}
+
+	// 再次同步没有变化
+	if changes, err = SyncDisabled(insts); err != nil || len(changes) != 0 {
+		t.Fatalf("changes = %+v, err = %v", changes, err)
+	}
+
+	// AD账户恢复 只移除自动写入的 disable
+	uac["lisi"] = "512"
+	if changes, err = SyncDisabled(insts); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Sam != "lisi" || changes[0].Disabled {
+		t.Fatalf("changes = %+v", changes)
+	}
+	if disabled("lisi") || !disabled("zhaoliu") || !disabled("wangwu") {
+		t.Error("只应启用 lisi")
+	}
+	if managed, _ := cache.SIsMember(DisabledKey, "default|lisi"); managed {
+		t.Error("启用后应移除自动禁用记录")
+	}
+
+	// 查询失败或查询不到ldap用户时不做修改
+	fetchLdapUsers = func(user *uuap.LdapAttributes) ([]*ldap.Entry, error) { return nil, errors.New("ldap unavailable") }
+	if _, err = SyncDisabled(insts); err == nil {
+		t.Error("LDAP查询失败时应返回错误")
+	}
+	fetchLdapUsers = func(user *uuap.LdapAttributes) ([]*ldap.Entry, error) { return nil, nil }
+	if _, err = SyncDisabled(insts); err == nil {
+		t.Error("未查询到LDAP用户时应返回错误")
+	}
+}
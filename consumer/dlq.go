@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"mq/conf"
+	"mq/transport"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultMaxRetries = 3 // 暂时失败默认最大重试次数
+
+	PropertyDLQReason      = "DLQ_REASON"      // 进入死信队列的原因
+	PropertyOriginMsgId    = "ORIGIN_MSG_ID"   // 原始消息Id
+	PropertyReconsumeTimes = "RECONSUME_TIMES" // 进入死信队列前的重试次数
+
+	replayIdleTimeout = 10 * time.Second // 重放死信队列时 无新消息超过该时间则结束
+)
+
+// DLQTopic 死信主题 默认为 工单主题_DLQ
+func DLQTopic() string {
+	if conf.Conf.RocketMQ.DLQTopic != "" {
+		return conf.Conf.RocketMQ.DLQTopic
+	}
+	return conf.Conf.RocketMQ.TopicName + "_DLQ"
+}
+
+// MaxRetries 暂时失败的最大重试次数
+func MaxRetries() int32 {
+	if conf.Conf.RocketMQ.MaxRetries > 0 {
+		return conf.Conf.RocketMQ.MaxRetries
+	}
+	return DefaultMaxRetries
+}
+
+// ConsumeUVPN 处理工单消息 成功或进入死信队列后确认消息并回复处理结果，暂时失败则稍后重试
+func ConsumeUVPN(ctx context.Context, msg *transport.Message) transport.Action {
+	result, err := HandleUVPN(msg)
+	if err == nil {
+		PublishResult(result, nil)
+		return transport.Ack
+	}
+	log.Error(err)
+
+	var reason string
+	if permanent, ok := IsPermanent(err); ok {
+		reason = permanent.Error()
+	} else if msg.Attempts >= MaxRetries() {
+		reason = fmt.Sprintf("超过最大重试次数[%d]: %v", MaxRetries(), err)
+	} else {
+		log.Warning(fmt.Sprintf("消息Id[%s] 第[%d]次处理失败，稍后重试", msg.Id, msg.Attempts+1))
+		return transport.Retry
+	}
+
+	if dlqErr := SendToDLQ(msg, reason); dlqErr != nil {
+		log.Error("Fail to send message to DLQ, err: ", dlqErr)
+		return transport.Retry
+	}
+	PublishResult(result, err)
+	return transport.Ack
+}
+
+// SendToDLQ 将处理失败的消息连同原因发送到死信主题
+func SendToDLQ(msg *transport.Message, reason string) (err error) {
+	dlqMsg := &transport.Message{
+		Topic: DLQTopic(),
+		Tag:   conf.Conf.RocketMQ.TopicName,
+		Keys:  []string{msg.Id},
+		Body:  msg.Body,
+	}
+	dlqMsg.WithProperty(PropertyDLQReason, reason)
+	dlqMsg.WithProperty(PropertyOriginMsgId, msg.Id)
+	dlqMsg.WithProperty(PropertyReconsumeTimes, strconv.Itoa(int(msg.Attempts)))
+
+	dlqMsgId, err := mqTransport.Publish(context.Background(), dlqMsg)
+	if err != nil {
+		return
+	}
+	log.Warning(fmt.Sprintf("[死信]消息Id[%s] 已进入死信主题[%s] 死信消息Id[%s] 原因: %s", msg.Id, DLQTopic(), dlqMsgId, reason))
+	return
+}
+
+// ReplayDLQ 将死信主题中未重放过的消息重新投递到工单主题 无新消息一段时间后结束
+func ReplayDLQ() (err error) {
+	t, err := NewTransport("uvpn-dlq-replay", true)
+	if err != nil {
+		return
+	}
+
+	var replayed int64
+	lastActive := time.Now().UnixNano()
+	err = t.Subscribe(DLQTopic(), "*", func(ctx context.Context, msg *transport.Message) transport.Action {
+		atomic.StoreInt64(&lastActive, time.Now().UnixNano())
+		replayMsgId, err := t.Publish(ctx, &transport.Message{
+			Topic: conf.Conf.RocketMQ.TopicName,
+			Tag:   conf.Conf.RocketMQ.TopicName,
+			Keys:  []string{msg.Property(PropertyOriginMsgId)},
+			Body:  msg.Body,
+		})
+		if err != nil {
+			log.Error("Fail to replay DLQ message, err: ", err)
+			return transport.Retry
+		}
+		atomic.AddInt64(&replayed, 1)
+		log.Info(fmt.Sprintf("[死信重放]原消息Id[%s] 新消息Id[%s] 死信原因: %s",
+			msg.Property(PropertyOriginMsgId), replayMsgId, msg.Property(PropertyDLQReason)))
+		return transport.Ack
+	})
+	if err != nil {
+		return
+	}
+	if err = t.Start(); err != nil {
+		return
+	}
+
+	for time.Since(time.Unix(0, atomic.LoadInt64(&lastActive))) < replayIdleTimeout {
+		time.Sleep(time.Second)
+	}
+	log.Info(fmt.Sprintf("[死信重放]共重放[%d]条消息", atomic.LoadInt64(&replayed)))
+	return t.Shutdown()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 永久失败的原因 重试也无法成功 直接进入死信队列
+const (
+	ReasonBadMessage      = "消息格式错误"
+	ReasonUnknownInstance = "未知的OpenVPN实例"
+	ReasonInvalidOrder    = "工单字段不合法"
+	ReasonUserNotFound    = "查无此人"
+	ReasonBadDestination  = "目标地址格式错误"
+)
+
+// PermanentError 永久失败 如查无此人、目标地址格式错误
+// 其他错误(LDAP、redis 不可用等)视为暂时失败 稍后重试
+type PermanentError struct {
+	Reason string
+	Err    error
+}
+
+func (e *PermanentError) Error() string {
+	if e.Err == nil {
+		return e.Reason
+	}
+	return fmt.Sprintf("%s: %v", e.Reason, e.Err)
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent 标记为永久失败
+func Permanent(reason string, err error) error {
+	return &PermanentError{Reason: reason, Err: err}
+}
+
+// IsPermanent 是否为永久失败
+func IsPermanent(err error) (*PermanentError, bool) {
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		return permanent, true
+	}
+	return nil, false
+}
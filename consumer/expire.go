@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"mq/audit"
+	"mq/cache"
+	"mq/ccd"
+	"mq/ovpn"
+	"mq/schema"
+	"mq/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ExpireKey 限时权限的过期时间 有序集合 成员为 实例|账号|网段|掩码 分数为过期时间戳(秒)
+	ExpireKey = "OVPNEXPIRE"
+	// DefaultExpireSweepInterval 默认过期权限扫描间隔
+	DefaultExpireSweepInterval = time.Minute
+)
+
+// expireMember 限时权限在有序集合中的成员名
+func expireMember(inst *ovpn.Instance, sam string, route ccd.Route) string {
+	return strings.Join([]string{inst.Name, sam, route.Network, route.Netmask}, "|")
+}
+
+// parseExpireMember 解析有序集合成员名 兼容不含实例名的旧记录
+func parseExpireMember(member string) (inst *ovpn.Instance, sam string, route ccd.Route, err error) {
+	fields := strings.Split(member, "|")
+	if len(fields) == 3 {
+		fields = append([]string{ovpn.DefaultInstanceName}, fields...)
+	}
+	if len(fields) != 4 {
+		err = fmt.Errorf("限时权限记录格式错误: %s", member)
+		return
+	}
+	if inst, err = GetInstance(fields[0]); err != nil {
+		return
+	}
+	return inst, fields[1], ccd.Route{Network: fields[2], Netmask: fields[3]}, nil
+}
+
+// UpdateExpiry 按工单操作维护用户路由的过期时间
+// expires 为工单中各路由的过期时间 0表示永久; added、removed 为本次向ccd文件新增、从ccd文件中删除的路由
+// 用户已持有的路由只更新已有的过期时间 已永久持有的路由不因限时工单变为限时
+func UpdateExpiry(inst *ovpn.Instance, sam, operation string, routes []ccd.Route, expires map[string]int64, added, removed []ccd.Route) (err error) {
+	var stale []string
+	for _, route := range removed {
+		stale = append(stale, expireMember(inst, sam, route))
+	}
+	isAdded := map[string]bool{}
+	for _, route := range added {
+		isAdded[route.Key()] = true
+	}
+	for _, route := range routes {
+		expireAt, member := expires[route.Key()], expireMember(inst, sam, route)
+		if operation == schema.OperationRevoke || expireAt == 0 {
+			stale = append(stale, member)
+			continue
+		}
+		if !isAdded[route.Key()] {
+			_, timed, err := cache.ZScore(ExpireKey, member)
+			if err != nil {
+				return err
+			}
+			if !timed {
+				continue
+			}
+		}
+		if err = cache.ZAdd(ExpireKey, float64(expireAt), member); err != nil {
+			return
+		}
+		log.Info(fmt.Sprintf("[限时权限]实例[%s] 账号[%s] 路由[%s] 过期时间[%s]", inst.Name, sam, route, time.Unix(expireAt, 0).Format("2006-01-02 15:04:05")))
+	}
+	return cache.ZRem(ExpireKey, stale...)
+}
+
+// ExpiredRoute 一条已回收的过期路由
+type ExpiredRoute struct {
+	Instance string `json:"instance"`
+	Sam      string `json:"sam"`
+	Route    string `json:"route"`
+}
+
+// SweepExpired 回收所有已过期的路由 返回本次从ccd文件中删除的路由
+// 格式错误或实例不存在的记录直接删除; ccd文件已删除或路由已不在ccd文件中时只删除记录
+func SweepExpired() (expired []*ExpiredRoute, err error) {
+	members, err := cache.ZRangeByScore(ExpireKey, 0, float64(time.Now().Unix()))
+	if err != nil {
+		return
+	}
+	for _, member := range members {
+		inst, sam, route, err := parseExpireMember(member)
+		if err != nil {
+			log.Error(fmt.Sprintf("[过期回收]%v 删除该记录", err))
+			if err = cache.ZRem(ExpireKey, member); err != nil {
+				log.Error(fmt.Sprintf("[过期回收]删除记录[%s]失败: %v", member, err))
+			}
+			continue
+		}
+
+		ccdFilePath := inst.CCDFilePath(sam)
+		if utils.IsFileExist(ccdFilePath) {
+			var removed []ccd.Route
+			record := &audit.Record{Action: audit.ActionExpire, Source: SourceExpire, Instance: inst.Name, Sam: sam}
+			err = ccd.Update(ccdFilePath, func(f *ccd.File) error {
+				record.Before = routeStrings(f.Routes())
+				removed, _ = f.RemoveRoutes([]ccd.Route{route})
+				record.Vip, record.After = f.VIP(), routeStrings(f.Routes())
+				return nil
+			})
+			if err != nil {
+				log.Error(fmt.Sprintf("[过期回收]实例[%s] 账号[%s] 路由[%s] 回收失败: %v", inst.Name, sam, route, err))
+				continue
+			}
+			if len(removed) > 0 {
+				recordAudit(record)
+				RequestFirewallSync()
+				// 要在删除记录之前断开 删除失败时下次扫描路由已不在ccd文件中 不会再断开
+				KillSessions(inst, sam, "过期回收")
+				expired = append(expired, &ExpiredRoute{Instance: inst.Name, Sam: sam, Route: route.String()})
+				log.Info(fmt.Sprintf("[过期回收]实例[%s] 账号[%s] 已回收过期路由[%s]", inst.Name, sam, route))
+			}
+		}
+		// 删除记录失败时下次扫描会再次处理 路由已不在ccd文件中 不会重复回收
+		if err = cache.ZRem(ExpireKey, member); err != nil {
+			log.Error(fmt.Sprintf("[过期回收]删除记录[%s]失败: %v", member, err))
+		}
+	}
+	if len(expired) > 0 {
+		log.Info(fmt.Sprintf("[过期回收]本次共回收[%d]条过期路由", len(expired)))
+	}
+	return expired, nil
+}
+
+// StartExpireSweeper 后台定时回收过期路由 返回停止函数
+func StartExpireSweeper(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultExpireSweepInterval
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := SweepExpired(); err != nil {
+					log.Error("[过期回收]扫描失败: ", err)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
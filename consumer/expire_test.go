@@ -0,0 +1,184 @@
+package main
+
+import (
+	"math"
+	"mq/cache"
+	"mq/ccd"
+	"mq/mgmt"
+	"mq/schema"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+var (
+	expireRoute1 = ccd.Route{Network: "10.16.3.0", Netmask: "255.255.255.0"}
+	expireRoute2 = ccd.Route{Network: "192.168.5.9", Netmask: "255.255.255.255"}
+)
+
+// expireMembers 有序集合中的全部限时权限记录
+func expireMembers(t *testing.T) []string {
+	members, err := cache.ZRangeByScore(ExpireKey, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// 授权时记录过期时间 永久授权、回收与替换删除的路由清除过期时间
+func TestUpdateExpiry(t *testing.T) {
+	setupConsumer(t, 0)
+	inst := DefaultInstance
+	routes := []ccd.Route{expireRoute1, expireRoute2}
+	future := time.Now().Add(time.Hour).Unix()
+
+	expires := map[string]int64{expireRoute1.Key(): future, expireRoute2.Key(): future}
+	if err := UpdateExpiry(inst, "zhangsan", schema.OperationGrant, routes, expires, routes, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"default|zhangsan|10.16.3.0|255.255.255.0", "default|zhangsan|192.168.5.9|255.255.255.255"}
+	if got := expireMembers(t); !reflect.DeepEqual(got, want) {
+		t.Fatalf("members = %v, want %v", got, want)
+	}
+
+	// 再次授权为永久
+	if err := UpdateExpiry(inst, "zhangsan", schema.OperationGrant, routes[:1], map[string]int64{}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := expireMembers(t); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("members after permanent grant = %v", got)
+	}
+
+	// 已持有的限时路由更新过期时间 已永久持有的路由不记录
+	later := map[string]int64{expireRoute1.Key(): future + 60, expireRoute2.Key(): future + 60}
+	if err := UpdateExpiry(inst, "zhangsan", schema.OperationGrant, routes, later, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := expireMembers(t); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("members after timed grant of held routes = %v", got)
+	}
+	if score, _, _ := cache.ZScore(ExpireKey, want[1]); int64(score) != future+60 {
+		t.Errorf("expiry of %s = %d, want %d", want[1], int64(score), future+60)
+	}
+
+	// 替换时删除的路由
+	if err := UpdateExpiry(inst, "zhangsan", schema.OperationReplace, routes[:1], map[string]int64{}, nil, routes[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if got := expireMembers(t); len(got) != 0 {
+		t.Errorf("members after replace = %v", got)
+	}
+
+	// 回收
+	if err := UpdateExpiry(inst, "zhangsan", schema.OperationGrant, routes, expires, routes, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateExpiry(inst, "zhangsan", schema.OperationRevoke, routes, map[string]int64{}, nil, routes); err != nil {
+		t.Fatal(err)
+	}
+	if got := expireMembers(t); len(got) != 0 {
+		t.Errorf("members after revoke = %v", got)
+	}
+}
+
+// 回收过期路由并断开在线会话 未过期的保留 格式错误与实例不存在的记录直接删除
+func TestSweepExpired(t *testing.T) {
+	_, dir := setupConsumer(t, 0)
+	inst := DefaultInstance
+	writeCCDFiles(t, dir, map[string]string{
+		"zhangsan": "ifconfig-push 10.11.0.2 255.255.0.0\npush \"route 10.16.3.0 255.255.255.0\"\npush \"route 192.168.5.9 255.255.255.255\"\n",
+	})
+	path := filepath.Join(dir, "zhangsan")
+	server, err := mgmt.NewFakeServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.Connect("zhangsan")
+	inst.Mgmt = mgmt.NewClient(&mgmt.Config{Addr: server.Addr()})
+	now := time.Now()
+	expires := map[string]int64{expireRoute1.Key(): now.Add(-time.Minute).Unix(), expireRoute2.Key(): now.Add(time.Hour).Unix()}
+	if err := UpdateExpiry(inst, "zhangsan", schema.OperationGrant, []ccd.Route{expireRoute1, expireRoute2}, expires, []ccd.Route{expireRoute1, expireRoute2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// ccd文件已删除的用户只删除记录
+	if err := UpdateExpiry(inst, "lisi", schema.OperationGrant, []ccd.Route{expireRoute1}, expires, []ccd.Route{expireRoute1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range []string{"bad", "tcp|wangwu|10.16.3.0|255.255.255.0"} {
+		if err := cache.ZAdd(ExpireKey, 1, member); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expired, err := SweepExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || *expired[0] != (ExpiredRoute{Instance: "default", Sam: "zhangsan", Route: expireRoute1.String()}) {
+		t.Errorf("expired = %+v", expired)
+	}
+	f, err := ccd.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if routes := f.Routes(); len(routes) != 1 || routes[0] != expireRoute2 {
+		t.Errorf("routes = %v", routes)
+	}
+	if got := expireMembers(t); !reflect.DeepEqual(got, []string{"default|zhangsan|192.168.5.9|255.255.255.255"}) {
+		t.Errorf("members = %v", got)
+	}
+	if killed := server.Killed(); !reflect.DeepEqual(killed, []string{"zhangsan"}) {
+		t.Errorf("killed = %v", killed)
+	}
+	if expired, err = SweepExpired(); err != nil || len(expired) != 0 {
+		t.Errorf("second sweep = %+v, %v", expired, err)
+	}
+}
+
+// 已永久持有的路由再次限时授权 过期回收后仍保留
+func TestTimedGrantKeepsPermanentRoute(t *testing.T) {
+	m, dir := setupConsumer(t, 0)
+	publishOrder(t, m, &schema.UVPNAuthority{SpName: "SP-1", Eid: "1001", DisplayName: "张三",
+		UVPNDestIps: []schema.UVPNDestIp{{DestIp: "192.168.5.9"}}})
+	publishOrder(t, m, &schema.UVPNAuthority{SpName: "SP-2", Eid: "1001", DisplayName: "张三",
+		UVPNDestIps: []schema.UVPNDestIp{{DestIp: "192.168.5.9", ExpireAt: time.Now().Add(-time.Minute).Unix()}}})
+	if got := expireMembers(t); len(got) != 0 {
+		t.Errorf("members = %v", got)
+	}
+
+	if expired, err := SweepExpired(); err != nil || len(expired) != 0 {
+		t.Errorf("sweep = %+v, %v", expired, err)
+	}
+	f, err := ccd.Load(filepath.Join(dir, "zhangsan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if routes := f.Routes(); len(routes) != 1 || routes[0] != expireRoute2 {
+		t.Errorf("永久路由不应被回收: %v", routes)
+	}
+}
+
+// 后台定时回收 停止后不再扫描
+func TestStartExpireSweeper(t *testing.T) {
+	_, dir := setupConsumer(t, 0)
+	writeCCDFiles(t, dir, map[string]string{"zhangsan": "push \"route 10.16.3.0 255.255.255.0\"\n"})
+	path := filepath.Join(dir, "zhangsan")
+	expires := map[string]int64{expireRoute1.Key(): time.Now().Add(-time.Minute).Unix()}
+	if err := UpdateExpiry(DefaultInstance, "zhangsan", schema.OperationGrant, []ccd.Route{expireRoute1}, expires, []ccd.Route{expireRoute1}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := StartExpireSweeper(10 * time.Millisecond)
+	defer stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(expireMembers(t)) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if f, err := ccd.Load(path); err != nil || len(f.Routes()) != 0 {
+		t.Errorf("expired route should be removed by sweeper: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"mq/ccd"
+	"mq/conf"
+	"mq/schema"
+	"mq/transport"
+)
+
+// UVPNResult 工单处理结果 发送到回复主题供 UUAP 关闭或重新打开工单
+type UVPNResult struct {
+	SpName    string                    `json:"spName"`    // 工单名
+	MsgId     string                    `json:"msgId"`     // 工单消息Id
+	Userid    string                    `json:"userid"`    // 工单中的用户id
+	Operation string                    `json:"operation"` // grant/revoke/replace
+	Instance  string                    `json:"instance"`  // OpenVPN 实例
+	Sam       string                    `json:"sam"`       // 用户账号
+	Vip       string                    `json:"vip"`       // 用户虚拟IP
+	Added     []string                  `json:"added"`     // 新增的路由
+	Removed   []string                  `json:"removed"`   // 回收的路由
+	Skipped   []string                  `json:"skipped"`   // 已授权(回收时为未授权)而跳过的路由
+	Rejected  []*schema.ValidationError `json:"rejected"`  // 被拒绝的目标地址及原因
+	Killed    int                       `json:"killed"`    // 回收权限后断开的在线会话数
+	Success   bool                      `json:"success"`
+	Error     string                    `json:"error,omitempty"`
+}
+
+// SetError 记录处理是否成功
+func (r *UVPNResult) SetError(err error) {
+	r.Success = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// routeStrings 路由转换为 network netmask 形式
+func routeStrings(routes []ccd.Route) (res []string) {
+	for _, route := range routes {
+		res = append(res, route.String())
+	}
+	return
+}
+
+// PublishResult 发送工单最终处理结果到回复主题 未配置回复主题时不发送
+func PublishResult(result *UVPNResult, err error) {
+	topic := conf.Conf.RocketMQ.ReplyTopic
+	if topic == "" || result == nil {
+		return
+	}
+	result.SetError(err)
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Error("Fail to marshal result, err: ", err)
+		return
+	}
+	replyMsgId, err := mqTransport.Publish(context.Background(), &transport.Message{
+		Topic: topic,
+		Tag:   topic,
+		Keys:  []string{result.MsgId, result.SpName},
+		Body:  data,
+	})
+	if err != nil {
+		log.Error("Fail to publish result, err: ", err)
+		return
+	}
+	log.Info(fmt.Sprintf("[回复]工单名[%s] 消息Id[%s] 处理结果已发送 回复消息Id[%s]", result.SpName, result.MsgId, replyMsgId))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"mq/ccd"
+	"mq/conf"
+	"mq/firewall"
+	"mq/ovpn"
+	"time"
+)
+
+const (
+	// DefaultFirewallInterval 默认定时全量同步防火墙规则的间隔 覆盖子命令等其他进程对ccd文件的修改
+	DefaultFirewallInterval = 5 * time.Minute
+	// firewallDebounce 收到同步请求后等待的时间 合并短时间内的多次修改
+	firewallDebounce = time.Second
+)
+
+// firewallSync 防火墙规则同步请求 未启用时为 nil
+var firewallSync chan struct{}
+
+// BuildRuleset 由所有实例的ccd文件生成 nftables 规则集 禁用的用户与没有VIP的ccd文件不放行任何目标
+func BuildRuleset() ([]byte, error) {
+	var insts []*firewall.Instance
+	for _, inst := range sortedInstances() {
+		fwInst, err := firewallInstance(inst)
+		if err != nil {
+			return nil, err
+		}
+		insts = append(insts, fwInst)
+	}
+	return firewall.Ruleset(conf.Conf.Firewall.Table, insts), nil
+}
+
+// firewallInstance 读取实例中所有用户的VIP与路由
+func firewallInstance(inst *ovpn.Instance) (*firewall.Instance, error) {
+	fwInst := &firewall.Instance{Name: inst.Name, Pool: inst.Allocator.Pool.String()}
+	rd, err := ioutil.ReadDir(inst.CCDDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range rd {
+		if !isCCDFile(file) {
+			continue
+		}
+		f, err := ccd.Load(inst.CCDFilePath(file.Name()))
+		if err != nil {
+			log.Warning(fmt.Sprintf("[防火墙]实例[%s] ccd文件[%s]解析失败 不放行: %v", inst.Name, file.Name(), err))
+			continue
+		}
+		if f.VIP() == "" || f.Disabled() {
+			continue
+		}
+		user := &firewall.User{Vip: f.VIP()}
+		for _, route := range f.Routes() {
+			// 未指定掩码时 OpenVPN 按主机路由处理
+			if route.Netmask == "" {
+				route.Netmask = ccd.DefaultNetmask
+			}
+			dest, err := firewall.Dest(route.Network, route.Netmask)
+			if err != nil {
+				log.Warning(fmt.Sprintf("[防火墙]实例[%s] 账号[%s] %v", inst.Name, file.Name(), err))
+				continue
+			}
+			user.Dests = append(user.Dests, dest)
+		}
+		fwInst.Users = append(fwInst.Users, user)
+	}
+	return fwInst, nil
+}
+
+// SyncFirewall 重新生成并应用 nftables 规则集 DryRun 时只写入日志
+func SyncFirewall() error {
+	ruleset, err := BuildRuleset()
+	if err != nil {
+		return err
+	}
+	if conf.Conf.Firewall.DryRun {
+		log.Info("[防火墙]DryRun 未应用规则集:\n" + string(ruleset))
+		return nil
+	}
+	if err = firewall.Apply(conf.Conf.Firewall.Nft, ruleset); err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("[防火墙]已应用规则集 %d字节", len(ruleset)))
+	return nil
+}
+
+// RequestFirewallSync 用户路由或VIP变化后请求同步防火墙规则 未启用时忽略
+func RequestFirewallSync() {
+	if firewallSync == nil {
+		return
+	}
+	select {
+	case firewallSync <- struct{}{}:
+	default: // 已有未处理的同步请求
+	}
+}
+
+// StartFirewallSync 启动时应用一次规则集 之后按同步请求与定时全量同步
+func StartFirewallSync() {
+	c := conf.Conf.Firewall
+	if !c.Enabled {
+		return
+	}
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultFirewallInterval
+	}
+	if err := SyncFirewall(); err != nil {
+		log.Error("[防火墙]同步失败: ", err)
+	}
+	firewallSync = make(chan struct{}, 1)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-firewallSync:
+				time.Sleep(firewallDebounce)
+			case <-ticker.C:
+			}
+			// 等待期间的同步请求一并处理
+			select {
+			case <-firewallSync:
+			default:
+			}
+			if err := SyncFirewall(); err != nil {
+				log.Error("[防火墙]同步失败: ", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// 由ccd文件生成规则集 禁用的用户、没有VIP的ccd文件与写入中的临时文件不放行任何目标
+func TestBuildRuleset(t *testing.T) {
+	_, dir := setupConsumer(t, 0)
+	files := map[string]string{
+		"zhangsan":       "ifconfig-push 10.11.0.2 255.255.0.0\npush \"route 10.16.3.0 255.255.255.0\"\npush \"route 192.168.5.9\"\n",
+		"lisi":           "ifconfig-push 10.11.0.3 255.255.0.0\npush \"route 10.16.3.0 255.255.255.0\"\ndisable\n",
+		"robot":          "push \"route 10.16.4.0 255.255.255.0\"\n",
+		".zhangsan.tmp1": "ifconfig-push 10.11.0.4 255.255.0.0\npush \"route 10.16.5.0 255.255.255.0\"\n",
+	}
+	writeCCDFiles(t, dir, files)
+
+	ruleset, err := BuildRuleset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(ruleset)
+	for _, want := range []string{
+		"10.11.0.2 . 10.16.3.0/24,\n",
+		"10.11.0.2 . 192.168.5.9/32\n",
+		"ip saddr 10.11.0.0/16 ip saddr . ip daddr @allow_default accept",
+		"ip saddr 10.11.0.0/16 drop",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ruleset missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "10.11.0.3") || strings.Contains(got, "10.16.4.0") || strings.Contains(got, "10.11.0.4") {
+		t.Errorf("禁用的用户与没有VIP的ccd文件不应放行:\n%s", got)
+	}
+}
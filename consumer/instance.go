@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mq/firewall"
+	"mq/ovpn"
+	"mq/uuap"
+)
+
+var (
+	Instances       = map[string]*ovpn.Instance{} // 实例名 -> OpenVPN 实例
+	DefaultInstance *ovpn.Instance                // 工单未指定实例时使用的实例 为配置中的第一个实例
+)
+
+// InitInstances 初始化 OpenVPN 实例 未配置实例列表时由 system、vipPool 与 management 构建默认实例
+func InitInstances(c *uuap.Config) (err error) {
+	configs := c.Instances
+	if len(configs) == 0 {
+		configs = []ovpn.InstanceConfig{{
+			Name:           ovpn.DefaultInstanceName,
+			CCDFilePath:    c.System.CCDFilePath,
+			DevCCDFilePath: c.System.DevCCDFilePath,
+			VipPool:        c.VipPool,
+			QuarantineDir:  c.System.QuarantineDir,
+			Management:     c.Management,
+			StatusFile:     c.System.StatusFile,
+		}}
+	}
+
+	instances := map[string]*ovpn.Instance{}
+	for idx := range configs {
+		inst, err := ovpn.NewInstance(&configs[idx], c.System.Dev)
+		if err != nil {
+			return err
+		}
+		if _, ok := instances[inst.Name]; ok {
+			return fmt.Errorf("OpenVPN 实例 %s 重复配置!", inst.Name)
+		}
+		// VIP池重叠时无法由VIP确定实例 防火墙规则也无法区分
+		for _, other := range instances {
+			if inst.Allocator.Pool.Overlaps(other.Allocator.Pool) {
+				return fmt.Errorf("OpenVPN 实例 %s 与 %s 的虚拟IP池重叠!", inst.Name, other.Name)
+			}
+			if firewall.SetName(inst.Name) == firewall.SetName(other.Name) {
+				return fmt.Errorf("OpenVPN 实例 %s 与 %s 的防火墙集合名相同 请修改实例名!", inst.Name, other.Name)
+			}
+		}
+		instances[inst.Name] = inst
+	}
+	Instances = instances
+	DefaultInstance = instances[configs[0].Name]
+	return
+}
+
+// GetInstance 按名称取实例 名称为空时取默认实例
+func GetInstance(name string) (*ovpn.Instance, error) {
+	if name == "" {
+		if DefaultInstance == nil {
+			return nil, errors.New("未初始化 OpenVPN 实例!")
+		}
+		return DefaultInstance, nil
+	}
+	inst, ok := Instances[name]
+	if !ok {
+		return nil, errors.New("未知的 OpenVPN 实例: " + name)
+	}
+	return inst, nil
+}
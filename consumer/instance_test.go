@@ -0,0 +1,82 @@
+package main
+
+import (
+	"mq/ovpn"
+	"mq/uuap"
+	"strings"
+	"testing"
+)
+
+// 未配置实例列表时由 system 与 vipPool 构建默认实例 配置了实例列表时默认实例为第一个实例
+func TestInitInstances(t *testing.T) {
+	conf := &uuap.Config{VipPool: ovpn.PoolConfig{CIDR: "10.11.0.0/16"}}
+	conf.System.CCDFilePath = "/etc/openvpn/ccd"
+	if err := InitInstances(conf); err != nil {
+		t.Fatal(err)
+	}
+	if inst, err := GetInstance(""); err != nil || inst.Name != ovpn.DefaultInstanceName || inst.Allocator.Key != ovpn.DefaultVipKey {
+		t.Errorf("GetInstance(\"\") = %+v, %v", inst, err)
+	}
+	if inst, err := GetInstance(ovpn.DefaultInstanceName); err != nil || inst != DefaultInstance {
+		t.Errorf("GetInstance(default) = %+v, %v", inst, err)
+	}
+
+	conf.Instances = []ovpn.InstanceConfig{
+		{Name: "udp", CCDFilePath: "/etc/openvpn/udp", VipPool: ovpn.PoolConfig{CIDR: "10.11.0.0/16"}},
+		{Name: "tcp", CCDFilePath: "/etc/openvpn/tcp", VipPool: ovpn.PoolConfig{CIDR: "10.12.0.0/16"}},
+	}
+	if err := InitInstances(conf); err != nil {
+		t.Fatal(err)
+	}
+	if len(Instances) != 2 || DefaultInstance != Instances["udp"] {
+		t.Fatalf("Instances = %v, DefaultInstance = %+v", Instances, DefaultInstance)
+	}
+	if inst, err := GetInstance("tcp"); err != nil || inst.Allocator.Key != "OVPNVIP:tcp" {
+		t.Errorf("GetInstance(tcp) = %+v, %v", inst, err)
+	}
+	// 旧的默认实例已不存在
+	for _, name := range []string{ovpn.DefaultInstanceName, "ipsec"} {
+		if _, err := GetInstance(name); err == nil || !strings.Contains(err.Error(), "未知的 OpenVPN 实例") {
+			t.Errorf("GetInstance(%s) = %v", name, err)
+		}
+	}
+}
+
+// 实例重复配置时返回错误 不修改已初始化的实例
+func TestInitInstancesDuplicate(t *testing.T) {
+	conf := &uuap.Config{Instances: []ovpn.InstanceConfig{
+		{Name: "udp", CCDFilePath: "/etc/openvpn/udp", VipPool: ovpn.PoolConfig{CIDR: "10.11.0.0/16"}},
+	}}
+	if err := InitInstances(conf); err != nil {
+		t.Fatal(err)
+	}
+	before := DefaultInstance
+	conf.Instances = append(conf.Instances, ovpn.InstanceConfig{Name: "udp", CCDFilePath: "/etc/openvpn/udp2", VipPool: ovpn.PoolConfig{CIDR: "10.12.0.0/16"}})
+	if err := InitInstances(conf); err == nil || !strings.Contains(err.Error(), "重复配置") {
+		t.Errorf("InitInstances = %v, want 重复配置", err)
+	}
+	if DefaultInstance != before || len(Instances) != 1 {
+		t.Errorf("失败时不应修改已初始化的实例")
+	}
+}
+
+// VIP池重叠或防火墙集合名相同的实例不能同时配置
+func TestInitInstancesConflict(t *testing.T) {
+	for _, c := range []struct {
+		names, cidrs [2]string
+		want         string
+	}{
+		{[2]string{"udp", "tcp"}, [2]string{"10.11.0.0/16", "10.11.8.0/24"}, "虚拟IP池重叠"},
+		{[2]string{"udp-1", "udp_1"}, [2]string{"10.11.0.0/16", "10.12.0.0/16"}, "防火墙集合名相同"},
+	} {
+		conf := &uuap.Config{}
+		for i := range c.names {
+			conf.Instances = append(conf.Instances, ovpn.InstanceConfig{
+				Name: c.names[i], CCDFilePath: "/etc/openvpn/" + c.names[i], VipPool: ovpn.PoolConfig{CIDR: c.cidrs[i]},
+			})
+		}
+		if err := InitInstances(conf); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("InitInstances(%v %v) = %v, want %s", c.names, c.cidrs, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"mq/ccd"
+	"mq/ovpn"
+	"sort"
+)
+
+// MigrateReport 迁移结果
+type MigrateReport struct {
+	Instance   string            `json:"instance"`
+	Files      int               `json:"files"`      // ccd文件数
+	Normalized []string          `json:"normalized"` // 格式被规范化的ccd文件
+	Owners     int               `json:"owners"`     // 写入归属表的VIP数
+	NextNum    uint32            `json:"nextNum"`    // 迁移后的高水位
+	Freed      int               `json:"freed"`      // 放入空闲列表的VIP数
+	Conflicts  map[string]string `json:"conflicts"`  // 与其他ccd文件VIP重复的文件 -> VIP 需手动处理
+	Invalid    map[string]string `json:"invalid"`    // VIP为空、不在VIP池或无法解析的文件 -> 原因
+}
+
+// MigrateInstance 规范化实例中已有的ccd文件 并由文件中的VIP重建VIP分配状态(归属表、高水位、空闲列表)
+// VIP重复时按文件名排序第一个文件为使用者; dryRun 时只报告不修改; 应在没有消费者运行时执行
+func MigrateInstance(inst *ovpn.Instance, dryRun bool) (report *MigrateReport, err error) {
+	report = &MigrateReport{Instance: inst.Name, Conflicts: map[string]string{}, Invalid: map[string]string{}}
+	rd, err := ioutil.ReadDir(inst.CCDDir)
+	if err != nil {
+		return
+	}
+	sort.Slice(rd, func(i, j int) bool { return rd[i].Name() < rd[j].Name() })
+
+	owners := map[uint32]string{}
+	for _, file := range rd {
+		if !isCCDFile(file) {
+			continue
+		}
+		sam, path := file.Name(), inst.CCDFilePath(file.Name())
+		report.Files++
+
+		f, err := ccd.Load(path)
+		if err != nil {
+			report.Invalid[sam] = err.Error()
+			continue
+		}
+		before := f.String()
+		f.Normalize()
+		if f.String() != before {
+			report.Normalized = append(report.Normalized, sam)
+			if !dryRun {
+				if err = ccd.Update(path, func(f *ccd.File) error {
+					f.Normalize()
+					return nil
+				}); err != nil {
+					return report, err
+				}
+				log.Info(fmt.Sprintf("[迁移]实例[%s] 已规范化ccd文件[%s]", inst.Name, sam))
+			}
+		}
+
+		vip := f.VIP()
+		if vip == "" {
+			report.Invalid[sam] = "没有 ifconfig-push"
+			continue
+		}
+		num, err := inst.Allocator.Pool.VipToNum(vip)
+		if err == nil {
+			_, err = inst.Allocator.Pool.NumToVip(num)
+		}
+		if err != nil {
+			report.Invalid[sam] = fmt.Sprintf("VIP[%s]: %v", vip, err)
+			continue
+		}
+		if owner, ok := owners[num]; ok {
+			report.Conflicts[sam] = vip
+			log.Warning(fmt.Sprintf("[迁移]实例[%s] ccd文件[%s]与[%s]的VIP[%s]重复", inst.Name, sam, owner, vip))
+			continue
+		}
+		owners[num] = sam
+	}
+
+	report.Owners = len(owners)
+	if dryRun {
+		return
+	}
+	if report.NextNum, report.Freed, err = inst.Allocator.Seed(owners); err != nil {
+		return
+	}
+	log.Info(fmt.Sprintf("[迁移]实例[%s] 归属表[%d]个VIP 高水位[%d] 空闲列表[%d]个VIP", inst.Name, report.Owners, report.NextNum, report.Freed))
+	return
+}
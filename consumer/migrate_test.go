@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// 规范化ccd文件 并由文件中的VIP重建归属表、高水位与空闲列表
+func TestMigrateInstance(t *testing.T) {
+	_, dir := setupConsumer(t, 0)
+	files := map[string]string{
+		"zhangsan": "ifconfig-push 10.11.0.5 255.255.0.0\npush \"route 10.16.3.0 255.255.255.0\"\n",
+		"lisi":     "ifconfig-push  10.11.0.3 255.255.0.0\npush \"route 192.168.5.9\"\npush \"route 192.168.5.9 255.255.255.255\"",
+		"wangwu":   "ifconfig-push 10.11.0.5 255.255.0.0\n",
+		"robot":    "push \"route 10.16.3.0 255.255.255.0\"\n",
+		"outside":  "ifconfig-push 10.12.0.2 255.255.0.0\n",
+	}
+	writeCCDFiles(t, dir, files)
+	inst := DefaultInstance
+
+	report, err := MigrateInstance(inst, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Files != 5 || report.Owners != 2 || len(report.Normalized) != 1 || report.Normalized[0] != "lisi" {
+		t.Errorf("dry run report = %+v", report)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "lisi")); string(data) != files["lisi"] {
+		t.Error("dry run should not modify files")
+	}
+	if owner, _ := inst.Allocator.Owner("10.11.0.3"); owner != "" {
+		t.Error("dry run should not seed allocator")
+	}
+
+	if report, err = MigrateInstance(inst, false); err != nil {
+		t.Fatal(err)
+	}
+	if report.Conflicts["zhangsan"] != "10.11.0.5" || len(report.Invalid) != 2 || report.Invalid["robot"] == "" || report.Invalid["outside"] == "" {
+		t.Errorf("report = %+v", report)
+	}
+	if report.NextNum != 6 || report.Freed != 2 {
+		t.Errorf("NextNum = %d, Freed = %d", report.NextNum, report.Freed)
+	}
+	want := "ifconfig-push 10.11.0.3 255.255.0.0\npush \"route 192.168.5.9 255.255.255.255\"\n"
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "lisi")); string(data) != want {
+		t.Errorf("lisi = %q, want %q", data, want)
+	}
+	for vip, want := range map[string]string{"10.11.0.3": "lisi", "10.11.0.5": "wangwu", "10.11.0.2": ""} {
+		if owner, _ := inst.Allocator.Owner(vip); owner != want {
+			t.Errorf("Owner(%s) = %q, want %q", vip, owner, want)
+		}
+	}
+
+	// 新用户复用空闲的VIP 空闲列表用完后从高水位继续分配
+	allocated := map[string]bool{}
+	for _, sam := range []string{"a", "b", "c"} {
+		vip, err := inst.Allocator.Allocate(sam)
+		if err != nil {
+			t.Fatal(err)
+		}
+		allocated[vip] = true
+	}
+	for _, vip := range []string{"10.11.0.2", "10.11.0.4", "10.11.0.6"} {
+		if !allocated[vip] {
+			t.Errorf("allocated %v, want %s", allocated, vip)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"mq/ccd"
+	"mq/ovpn"
+	"mq/schema"
+	"mq/transport"
+	"mq/utils"
+	"os"
+)
+
+// PlanGroup 计划模式的消费组 与正式消费者的消费组不同 各自收到全部工单 不影响正式消费
+const PlanGroup = "uvpn-plan"
+
+// CCDChange 工单对一个ccd文件的修改
+type CCDChange struct {
+	Instance string `json:"instance"`
+	Sam      string `json:"sam"`
+	Path     string `json:"path"`
+	Create   bool   `json:"create"` // 新建ccd文件
+	Vip      string `json:"vip"`    // 新建时为预估的VIP
+	Diff     string `json:"diff"`   // 统一格式的差异 没有修改时为空
+	before   string
+}
+
+// Planner 计算工单对ccd文件的修改而不写入
+// 修改后的内容保存在内存中 同一个 Planner 依次计算的工单基于之前工单修改后的内容
+type Planner struct {
+	files    map[string]string // ccd文件路径 -> 计划修改后的内容
+	newUsers map[string]int    // 实例名 -> 已计划新建的用户数 用于预估VIP
+	change   *CCDChange        // 当前工单的修改
+}
+
+// NewPlanner 新建 Planner
+func NewPlanner() *Planner {
+	return &Planner{files: map[string]string{}, newUsers: map[string]int{}}
+}
+
+// Plan 计算工单的处理结果与对ccd文件的修改 工单没有修改ccd文件时 change 为nil
+func (p *Planner) Plan(order *schema.UVPNAuthority, msgId string) (result *UVPNResult, change *CCDChange, err error) {
+	p.change = nil
+	result, err = applyOrder(order, "", msgId, p)
+	if err == nil && p.change != nil {
+		change = p.change
+		change.Instance, change.Sam = result.Instance, result.Sam
+	}
+	return
+}
+
+// exists 计划中或磁盘上是否有该ccd文件
+func (p *Planner) exists(path string) bool {
+	if _, ok := p.files[path]; ok {
+		return true
+	}
+	return utils.IsFileExist(path)
+}
+
+// content 计划中或磁盘上ccd文件的内容 不存在时为空
+func (p *Planner) content(path string) (string, error) {
+	if content, ok := p.files[path]; ok {
+		return content, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(data), err
+}
+
+// generate 按模版与预估的VIP生成新用户的ccd文件 与 GenerateCCD4User 对应
+func (p *Planner) generate(inst *ovpn.Instance, sam string) error {
+	temp, err := userTemplate(inst)
+	if err != nil {
+		return err
+	}
+	// 本次计划中已新建的用户占用前面的VIP
+	n := p.newUsers[inst.Name] + 1
+	vips, err := inst.Allocator.Preview(n)
+	if err != nil {
+		return err
+	}
+	if len(vips) < n {
+		return errors.New("虚拟IP池已分配完!")
+	}
+	path := inst.CCDFilePath(sam)
+	p.files[path] = ccd.ParseString(fmt.Sprintf(temp, vips[n-1])).String()
+	p.newUsers[inst.Name] = n
+	p.change = &CCDChange{Path: path, Create: true}
+	return nil
+}
+
+// update 与 ccd.Update 对应 修改后的内容保存在内存中
+func (p *Planner) update(path string, fn func(f *ccd.File) error) error {
+	content, err := p.content(path)
+	if err != nil {
+		return err
+	}
+	if p.change == nil {
+		p.change = &CCDChange{Path: path, before: content}
+	}
+	f := ccd.ParseString(content)
+	if err = fn(f); err != nil {
+		return err
+	}
+	p.files[path] = f.String()
+
+	// ccd文件路径一般为绝对路径 差异的文件名直接使用路径
+	oldName := path
+	if p.change.Create {
+		oldName = "/dev/null"
+	}
+	p.change.Vip = f.VIP()
+	p.change.Diff = ccd.Diff(oldName, path, p.change.before, p.files[path])
+	return nil
+}
+
+// PlanUVPN 计划模式的消息处理 只记录每个工单将对ccd文件做的修改 不回复、不重试也不发送到死信主题
+func PlanUVPN(ctx context.Context, msg *transport.Message) transport.Action {
+	order, err := schema.Decode(msg.Body)
+	if err != nil {
+		log.Error(fmt.Sprintf("[计划]消息Id[%s] 工单格式错误: %v", msg.Id, err))
+		return transport.Ack
+	}
+	// 实时消息以磁盘上的ccd文件为准 每个工单单独计算
+	result, change, err := NewPlanner().Plan(order, msg.Id)
+	logPlan(result, change, err)
+	return transport.Ack
+}
+
+// logPlan 记录工单的计划结果
+func logPlan(result *UVPNResult, change *CCDChange, err error) {
+	prefix := fmt.Sprintf("[计划]工单名[%s] 消息Id[%s] 操作[%s] 实例[%s] 账号[%s]",
+		result.SpName, result.MsgId, result.Operation, result.Instance, result.Sam)
+	switch {
+	case err != nil:
+		log.Error(prefix + " 处理失败: " + err.Error())
+	case change == nil || change.Diff == "":
+		log.Info(prefix + " ccd文件无修改")
+	default:
+		log.Info(prefix + " ccd文件修改:\n" + change.Diff)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"mq/cache"
+	"mq/schema"
+	"strings"
+	"testing"
+)
+
+// 计划模式不写ccd文件、不分配VIP 依次计算的工单基于前面工单修改后的内容
+func TestPlan(t *testing.T) {
+	_, dir := setupConsumer(t, 0)
+	inst, err := GetInstance("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPlanner()
+	grant := &schema.UVPNAuthority{Version: schema.Version, SpName: "SP-1", Eid: "1001", DisplayName: "张三",
+		Operation: schema.OperationGrant, UVPNDestIps: []schema.UVPNDestIp{{DestIp: "10.16.3.0/24"}}}
+	result, change, err := p.Plan(grant, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Sam != "zhangsan" || result.Vip != "10.11.0.2" || len(result.Added) != 1 {
+		t.Errorf("result = %+v", result)
+	}
+	if change == nil || !change.Create || change.Vip != "10.11.0.2" {
+		t.Fatalf("change = %+v", change)
+	}
+	for _, want := range []string{"--- /dev/null\n", "+ifconfig-push 10.11.0.2 255.255.0.0\n", "+push \"route 10.16.3.0 255.255.255.0\"\n"} {
+		if !strings.Contains(change.Diff, want) {
+			t.Errorf("diff missing %q:\n%s", want, change.Diff)
+		}
+	}
+
+	// 回收基于计划中的内容
+	revoke := &schema.UVPNAuthority{Version: schema.Version, SpName: "SP-2", Eid: "1001", DisplayName: "张三",
+		Operation: schema.OperationRevoke, UVPNDestIps: []schema.UVPNDestIp{{DestIp: "10.16.3.0/24"}}}
+	result, change, err = p.Plan(revoke, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Removed) != 1 || change == nil || change.Create {
+		t.Fatalf("result = %+v change = %+v", result, change)
+	}
+	if !strings.HasPrefix(change.Diff, "--- "+change.Path+"\n") || !strings.Contains(change.Diff, "-push \"route 10.16.3.0 255.255.255.0\"\n") {
+		t.Errorf("diff = \n%s", change.Diff)
+	}
+
+	// 没有写入ccd文件 也没有分配VIP
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("计划模式不应写入ccd文件: %d个文件", len(files))
+	}
+	if exists, _ := cache.Exists(inst.Allocator.Key); exists {
+		t.Error("计划模式不应分配VIP")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"mq/audit"
+	"mq/ccd"
+	"mq/ovpn"
+	"mq/uuap"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// DefaultMaxQuarantine 一次清理最多隔离的ccd文件数 防止ldap查询结果不全时隔离大量正常用户
+const DefaultMaxQuarantine = 20
+
+// CCDScanEntry ccd文件与ldap用户的对账结果
+type CCDScanEntry struct {
+	Instance     string `json:"instance"`
+	File         string `json:"file"`                  // ccd文件名 即账号名
+	Eid          string `json:"eid,omitempty"`         // 工号
+	DisplayName  string `json:"displayName,omitempty"` // 姓名
+	Vip          string `json:"vip,omitempty"`
+	Orphan       bool   `json:"orphan"`                // 没有对应的ldap用户
+	Disabled     bool   `json:"disabled"`              // AD账户已禁用
+	Expired      bool   `json:"expired"`               // AD账户已过期
+	CCDDisabled  bool   `json:"ccdDisabled"`           // ccd文件中有 disable 指令
+	DuplicateVip bool   `json:"duplicateVip"`          // 与同实例其他ccd文件的VIP重复
+	Quarantined  string `json:"quarantined,omitempty"` // 清理后隔离文件的路径
+	Error        string `json:"error,omitempty"`
+}
+
+// scanCSVHeader 对账报告CSV表头
+var scanCSVHeader = []string{"instance", "file", "eid", "displayName", "vip", "orphan", "disabled", "expired", "ccdDisabled", "duplicateVip", "quarantined", "error"}
+
+// ScanUVPNUserCCD 扫描实例中的ccd文件，去匹配ldap用户，报告没有ldap用户、AD账户已禁用或已过期的ccd文件以及重复的VIP
+// 扫描本身不修改ccd文件 清理见 QuarantineOrphans
+func ScanUVPNUserCCD(inst *ovpn.Instance) (entries []*CCDScanEntry, err error) {
+	users, err := fetchLdapUsers(&uuap.LdapAttributes{})
+	if err != nil {
+		return nil, err
+	}
+	// 没有用户时所有ccd文件都会被当作没有ldap用户 不做对账
+	if len(users) == 0 {
+		return nil, errors.New("未查询到LDAP用户")
+	}
+	now := time.Now()
+	ldapUser := map[string]*CCDScanEntry{} // ldap用户 账号名
+	for _, user := range users {
+		ldapUser[user.GetAttributeValue("sAMAccountName")] = &CCDScanEntry{
+			Eid:         user.GetAttributeValue("employeeNumber"),
+			DisplayName: user.GetAttributeValue("displayName"),
+			Disabled:    uuap.AccountDisabled(user),
+			Expired:     uuap.AccountExpired(user, now),
+		}
+	}
+
+	rd, err := ioutil.ReadDir(inst.CCDDir)
+	if err != nil {
+		return
+	}
+	orphans := 0
+	vips := map[string][]*CCDScanEntry{}
+	for _, file := range rd {
+		if !isCCDFile(file) {
+			continue
+		}
+		entry := &CCDScanEntry{Instance: inst.Name, File: file.Name()}
+		// ccd文件存在ldap用户账号名映射的 保留
+		if user, ok := ldapUser[file.Name()]; ok {
+			entry.Eid, entry.DisplayName, entry.Disabled, entry.Expired = user.Eid, user.DisplayName, user.Disabled, user.Expired
+		} else { // ccd文件名不存在ldap用户账号名映射的 报告出来，手动处理或隔离
+			entry.Orphan = true
+			orphans++
+			log.Warning(fmt.Sprintf("[扫描]实例[%s] ccd文件[%s]没有ldap用户映射，如果是机器账号可能是因为没有设置mail字段，在查询时被过滤掉了", inst.Name, file.Name()))
+		}
+		userCCD, err := ccd.Load(inst.CCDFilePath(file.Name()))
+		if err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.Vip, entry.CCDDisabled = userCCD.VIP(), userCCD.Disabled()
+		}
+		if entry.Vip != "" {
+			vips[entry.Vip] = append(vips[entry.Vip], entry)
+		}
+		entries = append(entries, entry)
+	}
+
+	duplicates := 0
+	for vip, same := range vips {
+		if len(same) < 2 {
+			continue
+		}
+		duplicates++
+		for _, entry := range same {
+			entry.DuplicateVip = true
+		}
+		log.Warning(fmt.Sprintf("[扫描]实例[%s] VIP[%s]被%d个ccd文件使用", inst.Name, vip, len(same)))
+	}
+	log.Info(fmt.Sprintf("[扫描]实例[%s] 共[%d]个ccd文件 其中[%d]个没有ldap用户映射 [%d]个VIP重复", inst.Name, len(entries), orphans, duplicates))
+	return entries, nil
+}
+
+// QuarantineOrphans 将没有ldap用户的ccd文件移入实例的隔离目录 不删除文件也不回收VIP 移回ccd目录即可恢复
+// 没有ldap用户的文件超过 max 个时不做任何修改 防止ldap查询结果不全时隔离大量正常用户
+func QuarantineOrphans(inst *ovpn.Instance, entries []*CCDScanEntry, max int) (moved int, err error) {
+	var orphans []*CCDScanEntry
+	for _, entry := range entries {
+		if entry.Instance == inst.Name && entry.Orphan {
+			orphans = append(orphans, entry)
+		}
+	}
+	if len(orphans) == 0 {
+		return
+	}
+	if len(orphans) > max {
+		return 0, fmt.Errorf("实例[%s]有%d个ccd文件没有ldap用户 超过单次清理上限%d 请确认ldap查询结果后调高上限", inst.Name, len(orphans), max)
+	}
+	if err = os.MkdirAll(inst.QuarantineDir, 0755); err != nil {
+		return
+	}
+
+	suffix := time.Now().Format("20060102150405")
+	for _, entry := range orphans {
+		dst := filepath.Join(inst.QuarantineDir, entry.File+"."+suffix)
+		var before []string
+		if f, err := ccd.Load(inst.CCDFilePath(entry.File)); err == nil {
+			before = routeStrings(f.Routes())
+		}
+		if err = ccd.Move(inst.CCDFilePath(entry.File), dst); err != nil {
+			return
+		}
+		recordAudit(&audit.Record{Action: audit.ActionQuarantine, Source: SourceScan, Instance: inst.Name, Sam: entry.File,
+			Vip: entry.Vip, Before: before, Detail: dst})
+		entry.Quarantined = dst
+		moved++
+		RequestFirewallSync()
+		log.Warning(fmt.Sprintf("[清理]实例[%s] ccd文件[%s]没有ldap用户 已隔离到[%s] VIP[%s]未回收", inst.Name, entry.File, dst, entry.Vip))
+	}
+	return
+}
+
+// WriteScanCSV 以CSV输出对账报告
+func WriteScanCSV(w io.Writer, entries []*CCDScanEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(scanCSVHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		err := cw.Write([]string{
+			e.Instance, e.File, e.Eid, e.DisplayName, e.Vip,
+			strconv.FormatBool(e.Orphan), strconv.FormatBool(e.Disabled), strconv.FormatBool(e.Expired),
+			strconv.FormatBool(e.CCDDisabled), strconv.FormatBool(e.DuplicateVip), e.Quarantined, e.Error,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"github.com/go-ldap/ldap/v3"
+	"io/ioutil"
+	"mq/uuap"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 对账报告 没有ldap用户、AD账户禁用与过期、VIP重复; 清理时隔离没有ldap用户的ccd文件
+func TestScanAndQuarantine(t *testing.T) {
+	_, dir := setupConsumer(t, 0)
+	files := map[string]string{
+		"zhangsan": "ifconfig-push 10.11.0.2 255.255.0.0\n",
+		"lisi":     "ifconfig-push 10.11.0.3 255.255.0.0\ndisable\n",
+		"wangwu":   "ifconfig-push 10.11.0.2 255.255.0.0\n",
+		"robot":    "ifconfig-push 10.11.0.9 255.255.0.0\n",
+	}
+	writeCCDFiles(t, dir, files)
+	fetchLdapUsers = func(user *uuap.LdapAttributes) ([]*ldap.Entry, error) {
+		return []*ldap.Entry{
+			ldap.NewEntry("CN=张三", map[string][]string{"sAMAccountName": {"zhangsan"}, "employeeNumber": {"1001"}, "userAccountControl": {"512"}, "accountExpires": {"0"}}),
+			ldap.NewEntry("CN=李四", map[string][]string{"sAMAccountName": {"lisi"}, "employeeNumber": {"1002"}, "userAccountControl": {"514"}, "accountExpires": {"0"}}),
+			ldap.NewEntry("CN=王五", map[string][]string{"sAMAccountName": {"wangwu"}, "employeeNumber": {"1003"}, "userAccountControl": {"512"}, "accountExpires": {"132854400000000000"}}),
+		}, nil
+	}
+	defer func() { fetchLdapUsers = uuap.FetchLdapUsers }()
+
+	entries, err := ScanUVPNUserCCD(DefaultInstance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]*CCDScanEntry{}
+	for _, e := range entries {
+		got[e.File] = e
+	}
+	if len(got) != 4 {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if e := got["zhangsan"]; e.Orphan || e.Disabled || e.Expired || !e.DuplicateVip || e.Eid != "1001" {
+		t.Errorf("zhangsan = %+v", e)
+	}
+	if e := got["lisi"]; !e.Disabled || e.Expired || !e.CCDDisabled || e.DuplicateVip {
+		t.Errorf("lisi = %+v", e)
+	}
+	if e := got["wangwu"]; !e.Expired || !e.DuplicateVip {
+		t.Errorf("wangwu = %+v", e)
+	}
+	if e := got["robot"]; !e.Orphan || e.Vip != "10.11.0.9" {
+		t.Errorf("robot = %+v", e)
+	}
+
+	// 超过上限时不隔离
+	if moved, err := QuarantineOrphans(DefaultInstance, entries, 0); err == nil || moved != 0 {
+		t.Errorf("QuarantineOrphans over limit = %d, %v", moved, err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "robot")); err != nil {
+		t.Fatal("robot should stay in ccd dir")
+	}
+
+	moved, err := QuarantineOrphans(DefaultInstance, entries, DefaultMaxQuarantine)
+	if err != nil || moved != 1 {
+		t.Fatalf("QuarantineOrphans = %d, %v", moved, err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "robot")); !os.IsNotExist(err) {
+		t.Error("robot should be moved out of ccd dir")
+	}
+	if filepath.Dir(got["robot"].Quarantined) != dir+".quarantine" {
+		t.Errorf("Quarantined = %s", got["robot"].Quarantined)
+	}
+	if data, err := ioutil.ReadFile(got["robot"].Quarantined); err != nil || string(data) != files["robot"] {
+		t.Errorf("quarantined file = %q, %v", data, err)
+	}
+	if owner, _ := DefaultInstance.Allocator.Owner("10.11.0.9"); owner != "" {
+		t.Errorf("quarantine should not touch allocator")
+	}
+
+	var buf bytes.Buffer
+	if err = WriteScanCSV(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 || len(records[0]) != len(scanCSVHeader) {
+		t.Errorf("csv = %v", records)
+	}
+
+	// 查询出错时即使有部分结果也不对账
+	fetchLdapUsers = func(user *uuap.LdapAttributes) ([]*ldap.Entry, error) {
+		return []*ldap.Entry{ldap.NewEntry("CN=张三", map[string][]string{"sAMAccountName": {"zhangsan"}})},
+			errors.New("size limit exceeded")
+	}
+	if entries, err = ScanUVPNUserCCD(DefaultInstance); err == nil || entries != nil {
+		t.Errorf("ScanUVPNUserCCD with ldap error = %v, %v", entries, err)
+	}
+}
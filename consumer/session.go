@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"mq/ccd"
+	"mq/mgmt"
+	"mq/ovpn"
+	"os"
+)
+
+// SessionEntry 在线会话与ccd文件、VIP分配的对账结果
+type SessionEntry struct {
+	Instance string `json:"instance"`
+	mgmt.Session
+	CCDVip      string `json:"ccdVip,omitempty"`   // ccd文件中的VIP
+	VipOwner    string `json:"vipOwner,omitempty"` // VIP分配记录中会话虚拟地址的使用者
+	NoCCD       bool   `json:"noCCD"`              // 没有对应的ccd文件
+	CCDDisabled bool   `json:"ccdDisabled"`        // ccd文件中有 disable 指令 重连后将被拒绝
+	VipMismatch bool   `json:"vipMismatch"`        // 会话的虚拟地址与ccd文件或VIP分配记录不一致
+	Error       string `json:"error,omitempty"`
+}
+
+// LoadStatus 查询实例的在线会话 statusFile 不为空时解析该文件 否则优先使用管理接口 其次为实例配置的状态文件
+func LoadStatus(inst *ovpn.Instance, statusFile string) (*mgmt.Status, error) {
+	switch {
+	case statusFile != "":
+		return mgmt.ParseStatusFile(statusFile)
+	case inst.Mgmt != nil:
+		return inst.Mgmt.Status()
+	case inst.StatusFile != "":
+		return mgmt.ParseStatusFile(inst.StatusFile)
+	}
+	return nil, fmt.Errorf("实例[%s]未配置管理接口或状态文件", inst.Name)
+}
+
+// ListSessions 实例的在线会话 按会话的通用名(即账号名)匹配ccd文件 按虚拟地址匹配VIP分配记录
+func ListSessions(inst *ovpn.Instance, statusFile string) (entries []*SessionEntry, err error) {
+	status, err := LoadStatus(inst, statusFile)
+	if err != nil {
+		return nil, err
+	}
+	owners, err := inst.Allocator.Owners()
+	if err != nil {
+		return nil, err
+	}
+
+	entries = []*SessionEntry{}
+	for _, session := range status.Sessions {
+		entry := &SessionEntry{Instance: inst.Name, Session: *session}
+		if num, err := inst.Allocator.Pool.VipToNum(session.VirtualAddress); err == nil {
+			entry.VipOwner = owners[num]
+		}
+		if !validSam(session.CommonName) {
+			entry.NoCCD = true
+		} else if f, err := ccd.Load(inst.CCDFilePath(session.CommonName)); os.IsNotExist(err) {
+			entry.NoCCD = true
+		} else if err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.CCDVip, entry.CCDDisabled = f.VIP(), f.Disabled()
+		}
+		entry.VipMismatch = (entry.CCDVip != "" && entry.CCDVip != session.VirtualAddress) ||
+			(entry.VipOwner != "" && entry.VipOwner != session.CommonName)
+		if entry.VipMismatch {
+			log.Warning(fmt.Sprintf("[在线会话]实例[%s] 账号[%s] 虚拟地址[%s] 与ccd文件VIP[%s]或VIP使用者[%s]不一致",
+				inst.Name, session.CommonName, session.VirtualAddress, entry.CCDVip, entry.VipOwner))
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// KillSessions 通过管理接口断开用户的在线会话 使修改后的ccd文件在重连时生效 返回断开的会话数
+// 实例未配置管理接口或断开失败时只记录日志 修改在用户下次连接时生效 调用方不因此失败
+func KillSessions(inst *ovpn.Instance, sam, reason string) int {
+	if inst.Mgmt == nil {
+		return 0
+	}
+	killed, err := inst.Mgmt.Kill(sam)
+	if err != nil {
+		log.Warning(fmt.Sprintf("[断开会话]实例[%s] 账号[%s] 断开失败，修改将在用户重连后生效: %v", inst.Name, sam, err))
+		return 0
+	}
+	if killed > 0 {
+		log.Info(fmt.Sprintf("[断开会话]实例[%s] 账号[%s] %s 已断开%d个在线会话", inst.Name, sam, reason, killed))
+	}
+	return killed
+}
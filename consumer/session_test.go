@@ -0,0 +1,58 @@
+package main
+
+import (
+	"mq/mgmt"
+	"testing"
+)
+
+// 在线会话与ccd文件、VIP分配记录对账
+func TestListSessions(t *testing.T) {
+	_, dir := setupConsumer(t, 0)
+	files := map[string]string{
+		"zhangsan": "ifconfig-push 10.11.0.2 255.255.0.0\n",
+		"lisi":     "ifconfig-push 10.11.0.3 255.255.0.0\ndisable\n",
+	}
+	writeCCDFiles(t, dir, files)
+	owners := map[uint32]string{}
+	for vip, owner := range map[string]string{"10.11.0.2": "zhangsan", "10.11.0.3": "lisi"} {
+		num, err := DefaultInstance.Allocator.Pool.VipToNum(vip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		owners[num] = owner
+	}
+	if _, _, err := DefaultInstance.Allocator.Seed(owners); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ListSessions(DefaultInstance, ""); err == nil {
+		t.Error("未配置管理接口或状态文件时应返回错误")
+	}
+
+	server, err := mgmt.NewFakeServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.AddSession(&mgmt.Session{CommonName: "zhangsan", RealAddress: "1.2.3.4:51234", VirtualAddress: "10.11.0.2"})
+	server.AddSession(&mgmt.Session{CommonName: "lisi", RealAddress: "5.6.7.8:1194", VirtualAddress: "10.11.0.2"})
+	server.AddSession(&mgmt.Session{CommonName: "robot", RealAddress: "9.9.9.9:1194", VirtualAddress: "10.11.0.9"})
+	DefaultInstance.Mgmt = mgmt.NewClient(&mgmt.Config{Addr: server.Addr()})
+
+	entries, err := ListSessions(DefaultInstance, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if e := entries[0]; e.CCDVip != "10.11.0.2" || e.VipOwner != "zhangsan" || e.VipMismatch || e.NoCCD || e.CCDDisabled {
+		t.Errorf("zhangsan = %+v", e)
+	}
+	if e := entries[1]; e.CCDVip != "10.11.0.3" || e.VipOwner != "zhangsan" || !e.VipMismatch || !e.CCDDisabled {
+		t.Errorf("lisi = %+v", e)
+	}
+	if e := entries[2]; !e.NoCCD || e.VipOwner != "" || e.VipMismatch {
+		t.Errorf("robot = %+v", e)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"mq/conf"
+	"mq/schema"
+	"mq/transport"
+	"strings"
+)
+
+const (
+	TransportRocketMQ = "rocketmq" // 默认
+	TransportKafka    = "kafka"
+	TransportMemory   = "memory" // 本地开发 工单从标准输入读取
+)
+
+var (
+	mqTransport transport.Transport // 工单、死信、回复共用的消息传输
+)
+
+// TransportDriver 配置的消息传输 默认 rocketmq
+func TransportDriver() string {
+	if conf.Conf.Transport == "" {
+		return TransportRocketMQ
+	}
+	return strings.ToLower(conf.Conf.Transport)
+}
+
+// NewTransport 按配置新建消息传输 group 为消费组 fromFirst 表示新消费组从最早的消息开始消费
+func NewTransport(group string, fromFirst bool) (transport.Transport, error) {
+	switch TransportDriver() {
+	case TransportRocketMQ:
+		return transport.NewRocketMQ(&transport.RocketMQConfig{
+			NameSrvAddrs: []string{conf.Conf.RocketMQ.Addr + ":" + conf.Conf.RocketMQ.Port},
+			GroupName:    group,
+			// 超过最大重试次数的消息由消费者发送到死信主题 broker 的重试上限要大于它
+			MaxReconsumeTimes: MaxRetries() + 1,
+			ConsumeFromFirst:  fromFirst,
+			Retry:             2,
+		})
+	case TransportKafka:
+		return transport.NewKafka(&transport.KafkaConfig{
+			Brokers:        conf.Conf.Kafka.Brokers,
+			GroupID:        group,
+			StartFromFirst: fromFirst,
+			RetryDelay:     conf.Conf.Kafka.RetryDelay,
+		})
+	case TransportMemory:
+		return transport.NewMemory(), nil
+	}
+	return nil, errors.New("未知的消息传输: " + conf.Conf.Transport)
+}
+
+// SubscribeUVPN 订阅工单主题 按主题名过滤tag
+func SubscribeUVPN(t transport.Transport) error {
+	return subscribeUVPN(t, ConsumeUVPN)
+}
+
+// subscribeUVPN 以指定的处理函数订阅工单主题
+func subscribeUVPN(t transport.Transport, handler transport.Handler) error {
+	return t.Subscribe(conf.Conf.RocketMQ.TopicName, conf.Conf.RocketMQ.TopicName, handler)
+}
+
+// FeedOrders 逐行读取工单(JSON Lines)发布到工单主题 用于本地开发
+func FeedOrders(r io.Reader, t transport.Transport) (err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if _, err := schema.Decode([]byte(line)); err != nil {
+			log.Error("工单格式错误: ", err)
+			continue
+		}
+		msgId, err := t.Publish(context.Background(), &transport.Message{
+			Topic: conf.Conf.RocketMQ.TopicName,
+			Tag:   conf.Conf.RocketMQ.TopicName,
+			Body:  []byte(line),
+		})
+		if err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("[本地]工单已发布 消息Id[%s]", msgId))
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,158 @@
+/*
+按用户已授权的路由生成 nftables 规则：push "route" 只告诉客户端如何路由，不能阻止用户手动添加路由;
+每个 OpenVPN 实例一个以 VIP . 目标网段 为键的集合，从实例VIP池发出的转发流量只放行集合中的目标，其余丢弃;
+整个规则集通过 nft -f 一次性替换，nft 在一个事务中执行，失败时保持原有规则;
+*/
+package firewall
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+const (
+	DefaultTable = "uvpn" // 默认 nftables 表名 表族为 inet
+	DefaultNft   = "nft"  // 默认 nft 命令
+)
+
+// User 用户的VIP与已授权的目标网段
+type User struct {
+	Vip   string
+	Dests []string // CIDR
+}
+
+// Instance 实例的VIP池与用户
+type Instance struct {
+	Name  string
+	Pool  string // VIP池 CIDR
+	Users []*User
+}
+
+// Dest 路由转换为 CIDR 形式的目标网段
+func Dest(network, netmask string) (string, error) {
+	ip := net.ParseIP(network).To4()
+	mask := net.ParseIP(netmask).To4()
+	if ip == nil || mask == nil {
+		return "", fmt.Errorf("路由不合法: %s %s", network, netmask)
+	}
+	ones, bits := net.IPMask(mask).Size()
+	if bits == 0 {
+		return "", fmt.Errorf("掩码不合法: %s", netmask)
+	}
+	return fmt.Sprintf("%s/%d", ip.Mask(net.IPMask(mask)), ones), nil
+}
+
+// Ruleset 生成替换整个表的规则集 实例、用户与目标网段排序后输出 相同输入生成相同的规则集
+func Ruleset(table string, insts []*Instance) []byte {
+	if table == "" {
+		table = DefaultTable
+	}
+	sorted := append([]*Instance(nil), insts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var b bytes.Buffer
+	// 先建再删 表不存在时 delete 也不会失败 之后的定义在同一事务中替换整个表
+	fmt.Fprintf(&b, "table inet %s\ndelete table inet %s\n\ntable inet %s {\n", table, table, table)
+	for _, inst := range sorted {
+		fmt.Fprintf(&b, "\tset %s {\n\t\ttype ipv4_addr . ipv4_addr\n\t\tflags interval\n", SetName(inst.Name))
+		if elements := instanceElements(inst); len(elements) > 0 {
+			fmt.Fprintf(&b, "\t\telements = {\n\t\t\t%s\n\t\t}\n", strings.Join(elements, ",\n\t\t\t"))
+		}
+		b.WriteString("\t}\n\n")
+	}
+	b.WriteString("\tchain forward {\n\t\ttype filter hook forward priority 0; policy accept;\n")
+	// 其他方向发起的连接 客户端的回包不限制
+	b.WriteString("\t\tct direction reply accept\n")
+	// 先放行全部实例集合中的VIP与目标 再丢弃各VIP池中其余的流量
+	for _, inst := range sorted {
+		fmt.Fprintf(&b, "\t\tip saddr %s ip saddr . ip daddr @%s accept\n", inst.Pool, SetName(inst.Name))
+	}
+	for _, inst := range sorted {
+		fmt.Fprintf(&b, "\t\tip saddr %s drop\n", inst.Pool)
+	}
+	b.WriteString("\t}\n}\n")
+	return b.Bytes()
+}
+
+// instanceElements 集合元素 VIP . 目标网段 同一VIP被其他目标网段包含的网段不重复写入(区间集合不允许重叠)
+func instanceElements(inst *Instance) (elements []string) {
+	users := append([]*User(nil), inst.Users...)
+	sort.Slice(users, func(i, j int) bool { return ipLess(users[i].Vip, users[j].Vip) })
+	for _, user := range users {
+		for _, dest := range mergeDests(user.Dests) {
+			elements = append(elements, user.Vip+" . "+dest.String())
+		}
+	}
+	return
+}
+
+// mergeDests 去掉被其他网段包含的网段 按地址排序
+func mergeDests(dests []string) (merged []*net.IPNet) {
+	var nets []*net.IPNet
+	for _, dest := range dests {
+		if _, n, err := net.ParseCIDR(dest); err == nil && n.IP.To4() != nil {
+			nets = append(nets, n)
+		}
+	}
+	// 掩码短的在前 包含它的网段一定已经加入
+	sort.Slice(nets, func(i, j int) bool {
+		oi, _ := nets[i].Mask.Size()
+		oj, _ := nets[j].Mask.Size()
+		if oi != oj {
+			return oi < oj
+		}
+		return bytes.Compare(nets[i].IP.To4(), nets[j].IP.To4()) < 0
+	})
+	for _, n := range nets {
+		covered := false
+		for _, m := range merged {
+			if m.Contains(n.IP) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			merged = append(merged, n)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return bytes.Compare(merged[i].IP.To4(), merged[j].IP.To4()) < 0 })
+	return
+}
+
+// ipLess 按地址比较IPv4地址
+func ipLess(a, b string) bool {
+	ia, ib := net.ParseIP(a).To4(), net.ParseIP(b).To4()
+	if ia == nil || ib == nil {
+		return a < b
+	}
+	return bytes.Compare(ia, ib) < 0
+}
+
+// SetName 实例对应的集合名 nftables 标识符只能包含字母、数字与下划线 不同的实例名可能对应同一个集合名
+func SetName(instance string) string {
+	return "allow_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, instance)
+}
+
+// Apply 通过 nft -f - 原子地应用规则集
+func Apply(nft string, ruleset []byte) error {
+	if nft == "" {
+		nft = DefaultNft
+	}
+	cmd := exec.Command(nft, "-f", "-")
+	cmd.Stdin = bytes.NewReader(ruleset)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrap(err, "Fail to apply nftables ruleset: "+strings.TrimSpace(string(out)))
+	}
+	return nil
+}
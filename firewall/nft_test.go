@@ -0,0 +1,62 @@
+package firewall
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "更新 testdata 下的 golden 文件")
+
+// checkGolden 与 testdata 下的 golden 文件比较
+func checkGolden(t *testing.T, name string, got []byte) {
+	golden := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("ruleset changed:\ngot\n%s\nwant\n%s", got, want)
+	}
+}
+
+// 实例与用户乱序输入 输出排序后的规则集 被包含的网段不重复写入
+func TestRulesetGolden(t *testing.T) {
+	insts := []*Instance{
+		{Name: "tcp-2", Pool: "10.12.0.0/16"},
+		{Name: "udp", Pool: "10.11.0.0/16", Users: []*User{
+			{Vip: "10.11.0.10", Dests: []string{"192.168.5.9/32"}},
+			{Vip: "10.11.0.2", Dests: []string{"10.16.3.8/29", "192.168.5.9/32", "10.16.3.0/24", "10.16.0.0/16", "bad"}},
+			{Vip: "10.11.0.3"},
+		}},
+	}
+	checkGolden(t, "ruleset.golden.nft", Ruleset("", insts))
+
+	// 输入顺序不影响输出
+	insts[0], insts[1] = insts[1], insts[0]
+	checkGolden(t, "ruleset.golden.nft", Ruleset(DefaultTable, insts))
+}
+
+func TestDest(t *testing.T) {
+	for _, c := range []struct{ network, netmask, want string }{
+		{"10.16.3.0", "255.255.255.0", "10.16.3.0/24"},
+		{"192.168.5.9", "255.255.255.255", "192.168.5.9/32"},
+		{"10.16.3.7", "255.255.0.0", "10.16.0.0/16"},
+	} {
+		if got, err := Dest(c.network, c.netmask); err != nil || got != c.want {
+			t.Errorf("Dest(%s, %s) = %s, %v", c.network, c.netmask, got, err)
+		}
+	}
+	for _, c := range [][2]string{{"10.16.3.0", "255.0.255.0"}, {"example.com", "255.255.255.255"}} {
+		if _, err := Dest(c[0], c[1]); err == nil {
+			t.Errorf("Dest(%s, %s) 应返回错误", c[0], c[1])
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package mgmt
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeServer 本地模拟的管理接口 用于测试
+// 只实现 kill 与 status 命令 会话通过 Connect 或 AddSession 添加
+type FakeServer struct {
+	Password string // 不为空时要求客户端先输入密码
+
+	listener net.Listener
+	mu       sync.Mutex
+	sessions []*Session
+	killed   []string
+	wg       sync.WaitGroup
+}
+
+// NewFakeServer 在 127.0.0.1 的随机端口启动模拟管理接口
+func NewFakeServer(password string) (*FakeServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &FakeServer{Password: password, listener: l}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr 监听地址
+func (s *FakeServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Connect 添加通用名为 cn 的在线会话
+func (s *FakeServer) Connect(cn string) {
+	s.AddSession(&Session{CommonName: cn, ConnectedSince: time.Now()})
+}
+
+// AddSession 添加在线会话 未指定 ClientID 时按添加顺序编号
+func (s *FakeServer) AddSession(session *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *session
+	if copied.ClientID == "" {
+		copied.ClientID = strconv.Itoa(len(s.sessions) + len(s.killed))
+	}
+	s.sessions = append(s.sessions, &copied)
+}
+
+// Killed 已断开会话的通用名 按断开顺序
+func (s *FakeServer) Killed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.killed...)
+}
+
+// Close 停止监听
+func (s *FakeServer) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *FakeServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		// 与 OpenVPN 一样同一时间只服务一个客户端
+		s.handle(conn)
+	}
+}
+
+func (s *FakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if s.Password != "" {
+		fmt.Fprint(conn, "ENTER PASSWORD:")
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if strings.TrimRight(line, "\r\n") != s.Password {
+			fmt.Fprint(conn, "ERROR: bad password\r\n")
+			return
+		}
+		fmt.Fprint(conn, "SUCCESS: password is correct\r\n")
+	}
+	fmt.Fprint(conn, ">INFO:OpenVPN Management Interface Version 3 -- type 'help' for more info\r\n")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "quit" || fields[0] == "exit":
+			return
+		case fields[0] == "kill" && len(fields) == 2:
+			fmt.Fprint(conn, s.kill(fields[1]))
+		case fields[0] == "status" && len(fields) == 2 && fields[1] == "3":
+			fmt.Fprint(conn, s.status())
+		default:
+			fmt.Fprintf(conn, "ERROR: unknown command [%s], enter 'help' for more options\r\n", fields[0])
+		}
+	}
+}
+
+// kill 断开通用名为 cn 的所有会话 返回管理接口的回复
+func (s *FakeServer) kill(cn string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var remain []*Session
+	for _, session := range s.sessions {
+		if session.CommonName != cn {
+			remain = append(remain, session)
+		}
+	}
+	n := len(s.sessions) - len(remain)
+	if n == 0 {
+		return fmt.Sprintf("ERROR: common name '%s' not found\r\n", cn)
+	}
+	s.sessions = remain
+	s.killed = append(s.killed, cn)
+	return fmt.Sprintf("SUCCESS: common name '%s' found, %d client(s) killed\r\n", cn, n)
+}
+
+// status 以 status-version 3 格式输出在线会话
+func (s *FakeServer) status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var b strings.Builder
+	fmt.Fprintf(&b, "TITLE\tOpenVPN 2.5.5 fake\r\nTIME\t%s\t%d\r\n", now.Format(time.ANSIC), now.Unix())
+	b.WriteString("HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tVirtual Address\tVirtual IPv6 Address\tBytes Received\tBytes Sent\t" +
+		"Connected Since\tConnected Since (time_t)\tUsername\tClient ID\tPeer ID\tData Channel Cipher\r\n")
+	for _, session := range s.sessions {
+		fmt.Fprintf(&b, "CLIENT_LIST\t%s\t%s\t%s\t\t%d\t%d\t%s\t%d\tUNDEF\t%s\t%s\tAES-256-GCM\r\n",
+			session.CommonName, session.RealAddress, session.VirtualAddress, session.BytesReceived, session.BytesSent,
+			session.ConnectedSince.Format(time.ANSIC), session.ConnectedSince.Unix(), session.ClientID, session.ClientID)
+	}
+	b.WriteString("HEADER\tROUTING_TABLE\tVirtual Address\tCommon Name\tReal Address\tLast Ref\tLast Ref (time_t)\r\n")
+	for _, session := range s.sessions {
+		fmt.Fprintf(&b, "ROUTING_TABLE\t%s\t%s\t%s\t%s\t%d\r\n",
+			session.VirtualAddress, session.CommonName, session.RealAddress, now.Format(time.ANSIC), now.Unix())
+	}
+	b.WriteString("GLOBAL_STATS\tMax bcast/mcast queue length\t0\r\nEND\r\n")
+	return b.String()
+}
@@ -0,0 +1,142 @@
+/*
+OpenVPN 管理接口(management interface)客户端：
+支持 TCP(management 127.0.0.1 7505)与 unix socket(management /run/openvpn/udp.sock unix)，可选密码;
+管理接口同一时间只接受一个客户端，每条命令单独建立连接，执行完即断开;
+*/
+package mgmt
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout 连接与单条命令的默认超时
+const DefaultTimeout = 5 * time.Second
+
+// Config 管理接口配置
+type Config struct {
+	Addr     string        // ip:port 或 unix socket 路径(以 / 开头或 unix: 前缀) 为空时不连接管理接口
+	Password string        // 管理接口密码 未配置密码时为空
+	Timeout  time.Duration // 连接与单条命令的超时 默认5秒
+}
+
+// Client 管理接口客户端
+type Client struct {
+	network string
+	addr    string
+	cfg     Config
+}
+
+// NewClient 新建管理接口客户端 未配置地址时返回 nil
+func NewClient(c *Config) *Client {
+	if c.Addr == "" {
+		return nil
+	}
+	cfg := *c
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	network, addr := "tcp", cfg.Addr
+	if strings.HasPrefix(addr, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+	} else if strings.HasPrefix(addr, "/") {
+		network = "unix"
+	}
+	return &Client{network: network, addr: addr, cfg: cfg}
+}
+
+// Addr 管理接口地址
+func (c *Client) Addr() string {
+	return c.cfg.Addr
+}
+
+// killedPattern kill 命令成功时的回复 SUCCESS: common name 'zhangsan' found, 2 client(s) killed
+var killedPattern = regexp.MustCompile(`(\d+) client\(s\) killed`)
+
+// Kill 断开通用名(即账号名)为 cn 的所有会话 返回断开的会话数 没有在线会话时返回 0
+func (c *Client) Kill(cn string) (int, error) {
+	if cn == "" || strings.ContainsAny(cn, " \t\r\n\"'") {
+		return 0, fmt.Errorf("通用名不合法: %q", cn)
+	}
+	reply, err := c.command("kill " + cn)
+	if err != nil {
+		// 没有在线会话 ERROR: common name 'zhangsan' not found
+		if strings.Contains(err.Error(), "not found") {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if m := killedPattern.FindStringSubmatch(reply); m != nil {
+		return strconv.Atoi(m[1])
+	}
+	return 1, nil
+}
+
+// command 执行单行回复(SUCCESS/ERROR)的命令
+func (c *Client) command(cmd string) (string, error) {
+	conn, r, err := c.dial()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if _, err = fmt.Fprintf(conn, "%s\n", cmd); err != nil {
+		return "", errors.Wrap(err, "Fail to send management command")
+	}
+	return readResult(r)
+}
+
+// dial 连接管理接口 配置了密码时完成认证
+func (c *Client) dial() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout(c.network, c.addr, c.cfg.Timeout)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Fail to connect management interface "+c.cfg.Addr)
+	}
+	conn.SetDeadline(time.Now().Add(c.cfg.Timeout))
+	r := bufio.NewReader(conn)
+	if c.cfg.Password != "" {
+		// 密码提示没有换行 ENTER PASSWORD:
+		if _, err = r.ReadString(':'); err != nil {
+			conn.Close()
+			return nil, nil, errors.Wrap(err, "Fail to read management password prompt")
+		}
+		if _, err = fmt.Fprintf(conn, "%s\n", c.cfg.Password); err == nil {
+			_, err = readResult(r)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, nil, errors.Wrap(err, "Fail to authenticate management interface")
+		}
+	}
+	return conn, r, nil
+}
+
+// readResult 读取 SUCCESS/ERROR 回复 跳过 > 开头的实时通知
+func readResult(r *bufio.Reader) (string, error) {
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case strings.HasPrefix(line, "SUCCESS:"):
+			return strings.TrimSpace(strings.TrimPrefix(line, "SUCCESS:")), nil
+		case strings.HasPrefix(line, "ERROR:"):
+			return "", errors.New(strings.TrimSpace(strings.TrimPrefix(line, "ERROR:")))
+		}
+	}
+}
+
+// readLine 读取一行 去掉行尾的 \r\n
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", errors.Wrap(err, "Fail to read management reply")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
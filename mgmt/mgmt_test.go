@@ -0,0 +1,53 @@
+package mgmt
+
+import (
+	"testing"
+)
+
+func TestKill(t *testing.T) {
+	for _, password := range []string{"", "secret"} {
+		s, err := NewFakeServer(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Connect("zhangsan")
+		s.Connect("zhangsan")
+
+		c := NewClient(&Config{Addr: s.Addr(), Password: password})
+		if n, err := c.Kill("zhangsan"); err != nil || n != 2 {
+			t.Errorf("password %q: Kill = %d, %v", password, n, err)
+		}
+		// 没有在线会话不是错误
+		if n, err := c.Kill("zhangsan"); err != nil || n != 0 {
+			t.Errorf("password %q: Kill offline = %d, %v", password, n, err)
+		}
+		if killed := s.Killed(); len(killed) != 1 || killed[0] != "zhangsan" {
+			t.Errorf("killed = %v", killed)
+		}
+		s.Close()
+	}
+}
+
+func TestKillErrors(t *testing.T) {
+	s, err := NewFakeServer("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err = NewClient(&Config{Addr: s.Addr(), Password: "wrong"}).Kill("zhangsan"); err == nil {
+		t.Error("密码错误时应返回错误")
+	}
+	if _, err = NewClient(&Config{Addr: s.Addr(), Password: "secret"}).Kill("zhang san"); err == nil {
+		t.Error("通用名含空白时应返回错误")
+	}
+	if NewClient(&Config{}) != nil {
+		t.Error("未配置地址时应返回 nil")
+	}
+	if c := NewClient(&Config{Addr: "/run/openvpn/udp.sock"}); c.network != "unix" {
+		t.Errorf("network = %s", c.network)
+	}
+	if c := NewClient(&Config{Addr: "unix:udp.sock"}); c.network != "unix" || c.addr != "udp.sock" {
+		t.Errorf("network = %s addr = %s", c.network, c.addr)
+	}
+}
@@ -0,0 +1,198 @@
+package mgmt
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Session 在线会话 对应状态中的 CLIENT_LIST 行
+type Session struct {
+	CommonName     string    `json:"commonName"`
+	RealAddress    string    `json:"realAddress"`
+	VirtualAddress string    `json:"virtualAddress"`
+	BytesReceived  int64     `json:"bytesReceived"`
+	BytesSent      int64     `json:"bytesSent"`
+	ConnectedSince time.Time `json:"connectedSince"`
+	ClientID       string    `json:"clientId,omitempty"` // 管理接口 client-kill 使用的Id OpenVPN 2.3 及之前没有
+}
+
+// Status OpenVPN 状态
+type Status struct {
+	Updated  time.Time  `json:"updated"` // 状态生成时间
+	Sessions []*Session `json:"sessions"`
+}
+
+// clientListColumns 没有 HEADER 行时 CLIENT_LIST 的默认列(OpenVPN 2.4)
+var clientListColumns = []string{"Common Name", "Real Address", "Virtual Address", "Virtual IPv6 Address",
+	"Bytes Received", "Bytes Sent", "Connected Since", "Connected Since (time_t)", "Username", "Client ID", "Peer ID"}
+
+// ParseStatus 解析 status-version 2(逗号分隔)或 3(制表符分隔)格式的状态 读到 END 或文件末尾结束
+// 按 HEADER 行确定各列的位置 兼容不同版本 OpenVPN 的列差异
+func ParseStatus(r io.Reader) (*Status, error) {
+	status := &Status{Sessions: []*Session{}}
+	columns := map[string]int{}
+	for idx, name := range clientListColumns {
+		columns[name] = idx
+	}
+	routes := map[string]string{} // 通用名|真实地址 -> 虚拟地址 CLIENT_LIST 中没有虚拟地址时使用
+
+	scanner := bufio.NewScanner(r)
+	sep, lineNo := "", 0
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		lineNo++
+		if line == "" || strings.HasPrefix(line, ">") {
+			continue
+		}
+		if sep == "" {
+			if sep = ","; strings.Contains(line, "\t") {
+				sep = "\t"
+			}
+		}
+		fields := strings.Split(line, sep)
+		switch fields[0] {
+		case "END":
+			return fillVirtualAddress(status, routes), nil
+		case "TIME":
+			if len(fields) >= 3 {
+				if sec, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+					status.Updated = time.Unix(sec, 0)
+				}
+			}
+		case "HEADER":
+			if len(fields) > 1 && fields[1] == "CLIENT_LIST" {
+				columns = map[string]int{}
+				for idx, name := range fields[2:] {
+					columns[name] = idx
+				}
+			}
+		case "CLIENT_LIST":
+			session, err := parseClient(fields[1:], columns)
+			if err != nil {
+				return nil, fmt.Errorf("状态第%d行: %v", lineNo, err)
+			}
+			status.Sessions = append(status.Sessions, session)
+		case "ROUTING_TABLE":
+			// ROUTING_TABLE,虚拟地址,通用名,真实地址,... iroute 学到的网段带 /
+			if len(fields) >= 4 && !strings.Contains(fields[1], "/") {
+				routes[fields[2]+"|"+fields[3]] = fields[1]
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return fillVirtualAddress(status, routes), nil
+}
+
+// ParseStatusFile 解析 OpenVPN status 指令写入的状态文件
+func ParseStatusFile(path string) (*Status, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseStatus(f)
+}
+
+// parseClient 按列名解析 CLIENT_LIST 行
+func parseClient(fields []string, columns map[string]int) (*Session, error) {
+	get := func(name string) string {
+		if idx, ok := columns[name]; ok && idx < len(fields) {
+			return fields[idx]
+		}
+		return ""
+	}
+	session := &Session{
+		CommonName:     get("Common Name"),
+		RealAddress:    get("Real Address"),
+		VirtualAddress: get("Virtual Address"),
+		ClientID:       get("Client ID"),
+	}
+	if session.CommonName == "" {
+		return nil, errors.New("CLIENT_LIST 缺少通用名")
+	}
+	var err error
+	if session.BytesReceived, err = parseInt(get("Bytes Received")); err != nil {
+		return nil, err
+	}
+	if session.BytesSent, err = parseInt(get("Bytes Sent")); err != nil {
+		return nil, err
+	}
+	if sec := get("Connected Since (time_t)"); sec != "" {
+		n, err := parseInt(sec)
+		if err != nil {
+			return nil, err
+		}
+		session.ConnectedSince = time.Unix(n, 0)
+	}
+	return session, nil
+}
+
+func parseInt(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("不是整数: %q", s)
+	}
+	return n, nil
+}
+
+// fillVirtualAddress 由路由表补全会话的虚拟地址
+func fillVirtualAddress(status *Status, routes map[string]string) *Status {
+	for _, session := range status.Sessions {
+		if session.VirtualAddress == "" {
+			session.VirtualAddress = routes[session.CommonName+"|"+session.RealAddress]
+		}
+	}
+	return status
+}
+
+// Status 通过管理接口 status 3 命令查询在线会话
+func (c *Client) Status() (*Status, error) {
+	conn, r, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err = fmt.Fprint(conn, "status 3\n"); err != nil {
+		return nil, errors.Wrap(err, "Fail to send management command")
+	}
+	// 回复以 END 结束 命令出错时为 ERROR 行
+	return ParseStatus(&statusReader{r: r})
+}
+
+// statusReader 读取管理接口的 status 回复 遇到 ERROR 行时返回错误
+type statusReader struct {
+	r   *bufio.Reader
+	buf []byte
+	end bool
+}
+
+func (s *statusReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.end {
+			return 0, io.EOF
+		}
+		line, err := readLine(s.r)
+		if err != nil {
+			return 0, err
+		}
+		if strings.HasPrefix(line, "ERROR:") {
+			return 0, errors.New(strings.TrimSpace(strings.TrimPrefix(line, "ERROR:")))
+		}
+		s.end = line == "END"
+		s.buf = []byte(line + "\n")
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,72 @@
+package mgmt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// OpenVPN 2.3 status-version 2 没有 Virtual IPv6 Address 与 Client ID 列
+const statusV2 = `TITLE,OpenVPN 2.3.18 x86_64-redhat-linux-gnu [SSL (OpenSSL)] [LZO] [EPOLL]
+TIME,Mon Jan  3 10:00:00 2022,1641204000
+HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username
+CLIENT_LIST,zhangsan,1.2.3.4:51234,10.11.0.2,1024,2048,Mon Jan  3 09:00:00 2022,1641200400,UNDEF
+CLIENT_LIST,lisi,5.6.7.8:1194,,10,20,Mon Jan  3 09:30:00 2022,1641202200,UNDEF
+HEADER,ROUTING_TABLE,Virtual Address,Common Name,Real Address,Last Ref,Last Ref (time_t)
+ROUTING_TABLE,10.11.0.2,zhangsan,1.2.3.4:51234,Mon Jan  3 10:00:00 2022,1641204000
+ROUTING_TABLE,10.11.0.3,lisi,5.6.7.8:1194,Mon Jan  3 10:00:00 2022,1641204000
+ROUTING_TABLE,192.168.10.0/24,lisi,5.6.7.8:1194,Mon Jan  3 10:00:00 2022,1641204000
+GLOBAL_STATS,Max bcast/mcast queue length,0
+END
+`
+
+func TestParseStatusV2(t *testing.T) {
+	status, err := ParseStatus(strings.NewReader(statusV2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Updated.Equal(time.Unix(1641204000, 0)) || len(status.Sessions) != 2 {
+		t.Fatalf("status = %+v", status)
+	}
+	s := status.Sessions[0]
+	if s.CommonName != "zhangsan" || s.RealAddress != "1.2.3.4:51234" || s.VirtualAddress != "10.11.0.2" ||
+		s.BytesReceived != 1024 || s.BytesSent != 2048 || !s.ConnectedSince.Equal(time.Unix(1641200400, 0)) || s.ClientID != "" {
+		t.Errorf("session = %+v", s)
+	}
+	// 虚拟地址由路由表补全 忽略 iroute 网段
+	if s := status.Sessions[1]; s.VirtualAddress != "10.11.0.3" {
+		t.Errorf("session = %+v", s)
+	}
+
+	if _, err = ParseStatus(strings.NewReader("CLIENT_LIST,zhangsan,1.2.3.4:1,10.11.0.2,,x,0\n")); err == nil {
+		t.Error("字节数不是整数时应返回错误")
+	}
+}
+
+// 管理接口 status 3 制表符分隔
+func TestStatusV3(t *testing.T) {
+	s, err := NewFakeServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	since := time.Unix(1641200400, 0)
+	s.AddSession(&Session{CommonName: "zhangsan", RealAddress: "1.2.3.4:51234", VirtualAddress: "10.11.0.2", BytesReceived: 1, BytesSent: 2, ConnectedSince: since})
+	s.AddSession(&Session{CommonName: "wang wu", RealAddress: "5.6.7.8:1194", VirtualAddress: "10.11.0.4", ConnectedSince: since})
+
+	status, err := NewClient(&Config{Addr: s.Addr()}).Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Sessions) != 2 {
+		t.Fatalf("sessions = %+v", status.Sessions)
+	}
+	if got := status.Sessions[0]; got.CommonName != "zhangsan" || got.VirtualAddress != "10.11.0.2" || got.BytesSent != 2 ||
+		!got.ConnectedSince.Equal(since) || got.ClientID != "0" {
+		t.Errorf("session = %+v", got)
+	}
+	// 通用名含空格
+	if got := status.Sessions[1]; got.CommonName != "wang wu" || got.ClientID != "1" {
+		t.Errorf("session = %+v", got)
+	}
+}
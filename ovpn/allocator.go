@@ -0,0 +1,197 @@
+package ovpn
+
+import (
+	"errors"
+	"fmt"
+	"mq/cache"
+	"sort"
+	"strconv"
+)
+
+// Allocator 基于redis的虚拟IP分配器
+// 已分配的虚拟IP记录在归属表中，用户ccd文件删除后虚拟IP放回空闲列表，分配时优先复用空闲列表再推进高水位
+type Allocator struct {
+	Key  string // 高水位(下一个未分配过的虚拟IP对应整数)的redis键 空闲列表与归属表以其为前缀
+	Pool *Pool  // 虚拟IP池
+}
+
+// NewAllocator 新建虚拟IP分配器
+func NewAllocator(key string, pool *Pool) *Allocator {
+	return &Allocator{Key: key, Pool: pool}
+}
+
+// freeKey 空闲虚拟IP集合
+func (a *Allocator) freeKey() string {
+	return a.Key + ":FREE"
+}
+
+// ownerKey 虚拟IP整数 -> 使用者 的哈希表
+func (a *Allocator) ownerKey() string {
+	return a.Key + ":OWNER"
+}
+
+// Allocate 为使用者分配虚拟IP 优先复用已回收的虚拟IP
+func (a *Allocator) Allocate(owner string) (vip string, err error) {
+	var num uint64
+	free, err := cache.SPop(a.freeKey())
+	if err != nil {
+		return
+	}
+	if free != "" {
+		if num, err = strconv.ParseUint(free, 10, 32); err != nil {
+			return
+		}
+	} else {
+		min, max := a.Pool.VipNumRange()
+		next, err := cache.FetchAndIncr(a.Key, int64(min), int64(max))
+		if err == cache.ErrSeqExhausted {
+			return "", errors.New("虚拟IP池已分配完!")
+		}
+		if err != nil {
+			return "", err
+		}
+		num = uint64(next)
+	}
+
+	if vip, err = a.Pool.NumToVip(uint32(num)); err != nil {
+		return
+	}
+	// 记录使用者失败时放回空闲列表 否则取出的虚拟IP不会再被分配
+	field := strconv.FormatUint(num, 10)
+	if err = cache.HSet(a.ownerKey(), field, owner); err != nil {
+		if rerr := cache.SAdd(a.freeKey(), field); rerr != nil {
+			return "", fmt.Errorf("%v; 放回空闲列表失败: %v", err, rerr)
+		}
+		return "", err
+	}
+	return
+}
+
+// Preview 预估接下来 n 次分配得到的虚拟IP 不修改分配状态 虚拟IP池剩余不足时返回的数量少于 n
+// 空闲列表按从小到大排在前面 实际分配时从空闲列表随机取出 因此复用的虚拟IP可能与预估的不同
+func (a *Allocator) Preview(n int) (vips []string, err error) {
+	members, err := cache.SMembers(a.freeKey())
+	if err != nil {
+		return
+	}
+	var nums []uint32
+	for _, member := range members {
+		num, err := strconv.ParseUint(member, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		nums = append(nums, uint32(num))
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	min, max := a.Pool.VipNumRange()
+	next := uint64(min)
+	exists, err := cache.Exists(a.Key)
+	if err != nil {
+		return
+	}
+	if exists {
+		value, err := cache.Get(a.Key)
+		if err != nil {
+			return nil, err
+		}
+		if next, err = strconv.ParseUint(value, 10, 32); err != nil {
+			return nil, err
+		}
+	}
+	for num := next; num <= uint64(max) && len(nums) < n; num++ {
+		nums = append(nums, uint32(num))
+	}
+
+	for _, num := range nums {
+		if len(vips) == n {
+			break
+		}
+		vip, err := a.Pool.NumToVip(num)
+		if err != nil {
+			return nil, err
+		}
+		vips = append(vips, vip)
+	}
+	return
+}
+
+// Release 回收虚拟IP 放回空闲列表供后续分配复用
+func (a *Allocator) Release(vip string) (err error) {
+	num, err := a.Pool.VipToNum(vip)
+	if err != nil {
+		return
+	}
+	if _, err = a.Pool.NumToVip(num); err != nil {
+		return
+	}
+	field := strconv.FormatUint(uint64(num), 10)
+	if err = cache.HDel(a.ownerKey(), field); err != nil {
+		return
+	}
+	return cache.SAdd(a.freeKey(), field)
+}
+
+// Owner 查询虚拟IP的使用者 未分配时返回空字符串
+func (a *Allocator) Owner(vip string) (string, error) {
+	num, err := a.Pool.VipToNum(vip)
+	if err != nil {
+		return "", err
+	}
+	return cache.HGet(a.ownerKey(), strconv.FormatUint(uint64(num), 10))
+}
+
+// Owners 全部已分配的虚拟IP 整数 -> 使用者
+func (a *Allocator) Owners() (owners map[uint32]string, err error) {
+	fields, err := cache.HGetAll(a.ownerKey())
+	if err != nil {
+		return
+	}
+	owners = make(map[uint32]string, len(fields))
+	for field, owner := range fields {
+		num, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		owners[uint32(num)] = owner
+	}
+	return
+}
+
+// Seed 由已有ccd文件中的虚拟IP重建分配状态 应在没有消费者运行时执行
+// 归属表替换为 owners; 高水位不低于已使用的最大虚拟IP加1; 高水位以下未使用的虚拟IP放入空闲列表
+func (a *Allocator) Seed(owners map[uint32]string) (next uint32, freed int, err error) {
+	min, max := a.Pool.VipNumRange()
+	hw := int64(min)
+	for num := range owners {
+		if _, err = a.Pool.NumToVip(num); err != nil {
+			return
+		}
+		if int64(num) >= hw {
+			hw = int64(num) + 1
+		}
+	}
+	if hw, err = cache.SetMax(a.Key, hw); err != nil {
+		return
+	}
+
+	if err = cache.Del(a.ownerKey(), a.freeKey()); err != nil {
+		return
+	}
+	for num, owner := range owners {
+		if err = cache.HSet(a.ownerKey(), strconv.FormatUint(uint64(num), 10), owner); err != nil {
+			return
+		}
+	}
+
+	var free []string
+	for num := min; int64(num) < hw && num <= max; num++ {
+		if _, ok := owners[num]; !ok {
+			free = append(free, strconv.FormatUint(uint64(num), 10))
+		}
+	}
+	if err = cache.SAdd(a.freeKey(), free...); err != nil {
+		return
+	}
+	return uint32(hw), len(free), nil
+}
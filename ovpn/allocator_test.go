@@ -0,0 +1,101 @@
+package ovpn
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"mq/cache"
+	"testing"
+)
+
+func newTestAllocator(t *testing.T, cidr string) (*Allocator, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	if err = cache.Init(&cache.Config{Addr: mr.Addr()}); err != nil {
+		t.Fatal(err)
+	}
+	return NewAllocator("OVPNVIP:test", newTestPool(t, cidr)), mr
+}
+
+// 分配、回收与复用 回收的虚拟IP优先分配
+func TestAllocateRelease(t *testing.T) {
+	a, _ := newTestAllocator(t, "10.11.0.0/16")
+	first, err := a.Allocate("zhangsan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := a.Allocate("lisi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != "10.11.0.2" || second != "10.11.0.3" {
+		t.Fatalf("Allocate = %s, %s", first, second)
+	}
+	if owner, err := a.Owner(first); err != nil || owner != "zhangsan" {
+		t.Errorf("Owner(%s) = %q, %v", first, owner, err)
+	}
+
+	if err = a.Release(first); err != nil {
+		t.Fatal(err)
+	}
+	if owner, _ := a.Owner(first); owner != "" {
+		t.Errorf("released vip still owned by %q", owner)
+	}
+	if vips, _ := a.Preview(2); len(vips) != 2 || vips[0] != first || vips[1] != "10.11.0.4" {
+		t.Errorf("Preview = %v", vips)
+	}
+	reused, err := a.Allocate("wangwu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused != first {
+		t.Errorf("Allocate after release = %s, want %s", reused, first)
+	}
+	if owner, _ := a.Owner(reused); owner != "wangwu" {
+		t.Errorf("Owner(%s) = %q", reused, owner)
+	}
+
+	if err = a.Release("10.12.0.2"); err == nil {
+		t.Error("不在虚拟IP池中的地址应返回错误")
+	}
+}
+
+// 虚拟IP池分配完时返回错误 回收后可以再次分配
+func TestAllocateExhausted(t *testing.T) {
+	a, _ := newTestAllocator(t, "10.11.0.0/29")
+	min, max := a.Pool.VipNumRange()
+	var vips []string
+	for i := min; i <= max; i++ {
+		vip, err := a.Allocate("user")
+		if err != nil {
+			t.Fatalf("Allocate #%d: %v", i, err)
+		}
+		vips = append(vips, vip)
+	}
+	if _, err := a.Allocate("user"); err == nil {
+		t.Fatal("虚拟IP池分配完时应返回错误")
+	}
+	if err := a.Release(vips[0]); err != nil {
+		t.Fatal(err)
+	}
+	if vip, err := a.Allocate("user"); err != nil || vip != vips[0] {
+		t.Errorf("Allocate after release = %s, %v", vip, err)
+	}
+}
+
+// 记录使用者失败时虚拟IP放回空闲列表
+func TestAllocateOwnerFailure(t *testing.T) {
+	a, mr := newTestAllocator(t, "10.11.0.0/16")
+	if err := a.Release("10.11.0.9"); err != nil {
+		t.Fatal(err)
+	}
+	// 归属表的键类型错误时 HSET 失败
+	mr.Set(a.ownerKey(), "broken")
+	if _, err := a.Allocate("zhangsan"); err == nil {
+		t.Fatal("记录使用者失败时应返回错误")
+	}
+	if ok, _ := mr.SIsMember(a.freeKey(), "9"); !ok {
+		t.Error("取出的虚拟IP应放回空闲列表")
+	}
+}
@@ -0,0 +1,89 @@
+package ovpn
+
+import (
+	"errors"
+	"fmt"
+	"mq/mgmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultInstanceName 未配置实例列表时由 system 与 vipPool 构建的默认实例名
+	DefaultInstanceName = "default"
+	// DefaultVipKey 默认实例虚拟IP高水位的redis键
+	DefaultVipKey = "OVPNVIP"
+	// QuarantineSuffix 默认隔离目录为 ccd目录加该后缀
+	QuarantineSuffix = ".quarantine"
+)
+
+// InstanceConfig OpenVPN 实例配置 每个实例有独立的ccd目录与虚拟IP池
+type InstanceConfig struct {
+	Name           string
+	CCDFilePath    string
+	DevCCDFilePath string      // 开发时的ccd地址
+	CCDTemplate    string      // 新用户ccd文件模版 %s 为分配的虚拟IP 为空时使用redis中的 OVPNTEMP
+	VipKey         string      // 虚拟IP高水位的redis键 默认实例为 OVPNVIP 其他实例为 OVPNVIP:<Name>
+	VipPool        PoolConfig  // 虚拟IP池
+	QuarantineDir  string      // 清理时没有ldap用户的ccd文件移入的目录 默认为 ccd目录.quarantine
+	Management     mgmt.Config // 管理接口 配置后回收权限、过期回收与禁用用户时断开用户的在线会话
+	StatusFile     string      // OpenVPN status 指令写入的状态文件 未配置管理接口时用于查询在线会话
+}
+
+// Instance OpenVPN 实例
+type Instance struct {
+	Name          string
+	CCDDir        string // 当前模式下的ccd文件目录
+	QuarantineDir string // 隔离目录 不能在ccd目录内
+	Template      string
+	Allocator     *Allocator
+	Mgmt          *mgmt.Client // 管理接口 未配置时为 nil
+	StatusFile    string
+}
+
+// NewInstance 根据配置构建实例 dev 为开发模式时使用 DevCCDFilePath
+func NewInstance(c *InstanceConfig, dev bool) (*Instance, error) {
+	if c.Name == "" {
+		return nil, errors.New("OpenVPN 实例名不可为空!")
+	}
+	ccdDir := c.CCDFilePath
+	if dev {
+		ccdDir = c.DevCCDFilePath
+	}
+	if ccdDir == "" {
+		return nil, fmt.Errorf("OpenVPN 实例 %s 的 ccd 路径不可为空!", c.Name)
+	}
+	pool, err := NewPool(&c.VipPool)
+	if err != nil {
+		return nil, fmt.Errorf("OpenVPN 实例 %s: %v", c.Name, err)
+	}
+	vipKey := c.VipKey
+	if vipKey == "" {
+		vipKey = DefaultVipKey
+		if c.Name != DefaultInstanceName {
+			vipKey += ":" + c.Name
+		}
+	}
+	quarantineDir := c.QuarantineDir
+	if quarantineDir == "" {
+		quarantineDir = filepath.Clean(ccdDir) + QuarantineSuffix
+	}
+	// OpenVPN 按用户名读取ccd目录下的文件 隔离的文件不能留在ccd目录内
+	if rel, err := filepath.Rel(ccdDir, quarantineDir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("OpenVPN 实例 %s 的隔离目录不能在 ccd 目录内!", c.Name)
+	}
+	return &Instance{
+		Name:          c.Name,
+		CCDDir:        ccdDir,
+		QuarantineDir: quarantineDir,
+		Template:      c.CCDTemplate,
+		Allocator:     NewAllocator(vipKey, pool),
+		Mgmt:          mgmt.NewClient(&c.Management),
+		StatusFile:    c.StatusFile,
+	}, nil
+}
+
+// CCDFilePath 用户ccd文件路径
+func (i *Instance) CCDFilePath(sam string) string {
+	return filepath.Join(i.CCDDir, sam)
+}
@@ -0,0 +1,57 @@
+package ovpn
+
+import (
+	"strings"
+	"testing"
+)
+
+// 虚拟IP高水位键、ccd目录与隔离目录的默认值
+func TestNewInstance(t *testing.T) {
+	pool := PoolConfig{CIDR: "10.11.0.0/16"}
+	for _, c := range []struct {
+		conf                             InstanceConfig
+		dev                              bool
+		wantKey, wantDir, wantQuarantine string
+	}{
+		{InstanceConfig{Name: DefaultInstanceName, CCDFilePath: "/etc/openvpn/ccd", VipPool: pool},
+			false, "OVPNVIP", "/etc/openvpn/ccd", "/etc/openvpn/ccd.quarantine"},
+		{InstanceConfig{Name: "tcp", CCDFilePath: "/etc/openvpn/tcp/", DevCCDFilePath: "/tmp/tcp", VipPool: pool},
+			false, "OVPNVIP:tcp", "/etc/openvpn/tcp/", "/etc/openvpn/tcp.quarantine"},
+		{InstanceConfig{Name: "tcp", CCDFilePath: "/etc/openvpn/tcp", DevCCDFilePath: "/tmp/tcp", VipPool: pool},
+			true, "OVPNVIP:tcp", "/tmp/tcp", "/tmp/tcp.quarantine"},
+		{InstanceConfig{Name: "udp", CCDFilePath: "/etc/openvpn/udp", VipKey: "UDPVIP", QuarantineDir: "/var/lib/uvpn/udp", VipPool: pool},
+			false, "UDPVIP", "/etc/openvpn/udp", "/var/lib/uvpn/udp"},
+	} {
+		inst, err := NewInstance(&c.conf, c.dev)
+		if err != nil {
+			t.Errorf("NewInstance(%s): %v", c.conf.Name, err)
+			continue
+		}
+		if inst.Allocator.Key != c.wantKey || inst.CCDDir != c.wantDir || inst.QuarantineDir != c.wantQuarantine {
+			t.Errorf("NewInstance(%s) = key %s dir %s quarantine %s", c.conf.Name, inst.Allocator.Key, inst.CCDDir, inst.QuarantineDir)
+		}
+		if inst.Mgmt != nil {
+			t.Errorf("NewInstance(%s): 未配置管理接口时 Mgmt 应为 nil", c.conf.Name)
+		}
+	}
+}
+
+// 实例名、ccd路径、虚拟IP池与隔离目录不合法
+func TestNewInstanceError(t *testing.T) {
+	pool := PoolConfig{CIDR: "10.11.0.0/16"}
+	for _, c := range []struct {
+		conf InstanceConfig
+		dev  bool
+		want string
+	}{
+		{InstanceConfig{CCDFilePath: "/etc/openvpn/ccd", VipPool: pool}, false, "实例名不可为空"},
+		{InstanceConfig{Name: "udp", VipPool: pool}, false, "ccd 路径不可为空"},
+		{InstanceConfig{Name: "udp", CCDFilePath: "/etc/openvpn/ccd", VipPool: pool}, true, "ccd 路径不可为空"},
+		{InstanceConfig{Name: "udp", CCDFilePath: "/etc/openvpn/ccd", VipPool: PoolConfig{CIDR: "10.11.0.0"}}, false, "OpenVPN 实例 udp"},
+		{InstanceConfig{Name: "udp", CCDFilePath: "/etc/openvpn/ccd", QuarantineDir: "/etc/openvpn/ccd/old", VipPool: pool}, false, "隔离目录不能在 ccd 目录内"},
+	} {
+		if _, err := NewInstance(&c.conf, c.dev); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("NewInstance(%+v) = %v, want %s", c.conf, err, c.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 /*
-支持 OpenVPN 虚拟IP池的动态给定：但因 subnet 拓扑要求, OpenVPN 的虚拟IP池只能是 255.255.0.0(/16) 或更高;
-支持 CIDR 与 uint64 整数的互相转换,以便从缓存中读取大整数并将其转换为当前可分配虚拟IP地址;
+支持 OpenVPN 虚拟IP池的动态给定：虚拟IP池网段、保留给服务端的地址数与拓扑均来自配置文件;
+因 subnet 拓扑要求, OpenVPN 的虚拟IP池只能是 255.255.0.0(/16) 或更高;
+支持 CIDR 与 uint32 整数的互相转换,以便从缓存中读取大整数并将其转换为当前可分配虚拟IP地址;
 */
 package ovpn
 
@@ -11,55 +12,103 @@ import (
 	"net"
 )
 
-// OpenVPN 用户虚拟IP网段CIDR表示形式
-// 该网段最大与最小可用虚拟IP 默认最小IP留给VPN服务端
-var ovpnVipPool = "10.11.0.0/16"
-var ovpnVipPoolCidr *net.IPNet
+const (
+	TopologySubnet = "subnet" // subnet 拓扑 虚拟IP池掩码不能宽于/16
+	minSubnetMask  = 16
+)
+
+// PoolConfig 虚拟IP池配置
+type PoolConfig struct {
+	CIDR     string // OpenVPN 用户虚拟IP网段CIDR表示形式 如 10.11.0.0/16
+	Reserved uint32 // 网段开头(网络地址之后)保留给VPN服务端的地址数 默认1
+	Topology string // OpenVPN 拓扑 默认 subnet
+}
+
+// Pool 虚拟IP池
+// 整数为虚拟IP相对网段网络地址的偏移量 网络地址之后的 Reserved 个地址留给VPN服务端
+type Pool struct {
+	cidr   *net.IPNet
+	base   uint32 // 网段网络地址对应整数
+	minNum uint32 // 最小可分配虚拟IP对应整数
+	maxNum uint32 // 最大可分配虚拟IP对应整数
+}
 
-// 虚拟IP池网段最小/最大IP 最小/最大可分配虚拟IP
-var minIp, maxIp, minVip, maxVip string
-var minIpNum, maxIpNum, minVipNum, maxVipNum, ipLen, vipLen uint32
+// NewPool 根据配置构建虚拟IP池
+func NewPool(c *PoolConfig) (*Pool, error) {
+	if c.CIDR == "" {
+		return nil, errors.New("虚拟IP池网段不可为空!")
+	}
+	_, cidr, err := net.ParseCIDR(c.CIDR)
+	if err != nil || cidr.IP.To4() == nil {
+		return nil, fmt.Errorf("虚拟IP池网段 %s 不是合法的IPv4 CIDR!", c.CIDR)
+	}
+	maskLen, _ := cidr.Mask.Size()
+	topology := c.Topology
+	if topology == "" {
+		topology = TopologySubnet
+	}
+	if topology == TopologySubnet && maskLen < minSubnetMask {
+		return nil, fmt.Errorf("因 subnet 拓扑要求, OpenVPN 的虚拟IP池只能是 255.255.0.0(/16) 或更高, 当前为 %s!", c.CIDR)
+	}
+	reserved := c.Reserved
+	if reserved == 0 {
+		reserved = 1
+	}
 
-func init() {
-	_, ovpnVipPoolCidr, _ = net.ParseCIDR(ovpnVipPool)
-	maskLen, _ := ovpnVipPoolCidr.Mask.Size()
-	if maskLen < 16 {
-		fmt.Println(errors.New("因 subnet 拓扑要求, OpenVPN 的虚拟IP池只能是 255.255.0.0(/16) 或更高;"))
+	// 网段地址数 去掉网段末尾的地址后为最大可分配虚拟IP
+	ipLen := uint32(1) << uint(32-maskLen)
+	if ipLen < 4 || reserved+1 > ipLen-3 {
+		return nil, fmt.Errorf("虚拟IP池网段 %s 去掉保留地址后无可分配虚拟IP!", c.CIDR)
 	}
-	// 虚拟IP池网段最大最小IP
-	minIp = AssignVip(ovpnVipPoolCidr, 0)
-	minIpNum, _ = VipToNum(minIp)
-	ipLen = 2 << (31 - maskLen)
-	maxIp = AssignVip(ovpnVipPoolCidr, ipLen)
-	maxIpNum, _ = VipToNum(maxIp)
-	// 虚拟IP池网段最大最小可用虚拟IP
-	minVip = AssignVip(ovpnVipPoolCidr, 2)
-	minVipNum, _ = VipToNum(minVip)
-	vipLen = ipLen - 3
-	maxVip = AssignVip(ovpnVipPoolCidr, vipLen)
-	maxVipNum, _ = VipToNum(maxVip)
+	return &Pool{
+		cidr:   cidr,
+		base:   binary.BigEndian.Uint32(cidr.IP.To4()),
+		minNum: reserved + 1,
+		maxNum: ipLen - 3,
+	}, nil
+}
+
+// String 虚拟IP池网段
+func (p *Pool) String() string {
+	return p.cidr.String()
+}
+
+// Contains 虚拟IP是否在池内
+func (p *Pool) Contains(vip string) bool {
+	ip := net.ParseIP(vip)
+	return ip != nil && p.cidr.Contains(ip)
+}
+
+// Overlaps 两个虚拟IP池的网段是否重叠
+func (p *Pool) Overlaps(o *Pool) bool {
+	return p.cidr.Contains(o.cidr.IP) || o.cidr.Contains(p.cidr.IP)
 }
 
 // VipToNum 虚拟IP转换为整数
-func VipToNum(vip string) (num uint32, err error) {
+func (p *Pool) VipToNum(vip string) (num uint32, err error) {
 	ip := net.ParseIP(vip)
-	if !ovpnVipPoolCidr.Contains(ip) {
+	if ip == nil || !p.cidr.Contains(ip) {
 		return 0, errors.New("该IP不在ovpn虚拟IP池内！")
 	}
 	num = binary.BigEndian.Uint32(ip.To4())
-	num -= minIpNum
+	num -= p.base
 	return
 }
 
 // NumToVip 整数转换为虚拟IP
-func NumToVip(num uint32) (vip string, err error) {
-	if num < 2 || num > vipLen {
+func (p *Pool) NumToVip(num uint32) (vip string, err error) {
+	if num < p.minNum || num > p.maxNum {
 		return "", errors.New("该整数对应IP不在用户可分配虚拟IP范围!")
 	}
-	vip = AssignVip(ovpnVipPoolCidr, num)
+	vip = AssignVip(p.cidr, num)
 	return
 }
 
+// VipNumRange 用户可分配虚拟IP对应整数的范围
+func (p *Pool) VipNumRange() (min, max uint32) {
+	return p.minNum, p.maxNum
+}
+
 // AssignVip 分配虚拟IP计算方法
 func AssignVip(cidr *net.IPNet, num uint32) string {
 	ip := make(net.IP, len(cidr.IP.To4()))
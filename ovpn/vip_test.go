@@ -1,63 +1,110 @@
 package ovpn
 
 import (
-	"fmt"
 	"testing"
 )
 
+func newTestPool(t *testing.T, cidr string) *Pool {
+	pool, err := NewPool(&PoolConfig{CIDR: cidr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
 // 功能测试 ip转整数
 func TestVipToNum(t *testing.T) {
-	fmt.Println("========[功能测试]========")
-	num, err := VipToNum("10.121.3.155")
+	pool := newTestPool(t, "10.121.0.0/16")
+	num, err := pool.VipToNum("10.121.3.155")
 	if err != nil {
-		fmt.Println(err)
+		t.Fatal(err)
+	}
+	if num != 3*256+155 {
+		t.Errorf("IP转换为整数:%v", num)
 	}
-	fmt.Printf("IP转换为整数:%v\n", num)
 }
 
 // 功能测试 整数转ip
 func TestNumToVip(t *testing.T) {
-	ip, err := NumToVip(932)
+	pool := newTestPool(t, "10.11.0.0/16")
+	ip, err := pool.NumToVip(932)
 	if err != nil {
-		fmt.Println(err)
+		t.Fatal(err)
+	}
+	if ip != "10.11.3.164" {
+		t.Errorf("整数转换为IP:%v", ip)
 	}
-	fmt.Printf("整数转换为IP:%v\n", ip)
-	fmt.Println("========[功能测试]========")
 }
 
 // 边界测试 ip转整数
 func TestVipToNumBoundary(t *testing.T) {
-	fmt.Println("========[边界测试]========")
-	var vips = [...]string{"10.121.0.0", "10.120.255.255", "10.121.255.253", "10.121.255.254", "10.121.255.255", "10.122.0.0"}
-	for index, vip := range vips {
-		num, err := VipToNum(vip)
-		fmt.Printf("%v.IP %v 转换为整数:%v\n", index, vip, num)
-		if err != nil {
-			fmt.Println(err)
+	pool := newTestPool(t, "10.121.0.0/16")
+	var cases = []struct {
+		vip string
+		num uint32
+		ok  bool
+	}{
+		{"10.121.0.0", 0, true},
+		{"10.120.255.255", 0, false},
+		{"10.121.255.253", 65533, true},
+		{"10.121.255.254", 65534, true},
+		{"10.121.255.255", 65535, true},
+		{"10.122.0.0", 0, false},
+		{"10.121.3", 0, false},
+	}
+	for _, c := range cases {
+		num, err := pool.VipToNum(c.vip)
+		if (err == nil) != c.ok || num != c.num {
+			t.Errorf("IP %v 转换为整数:%v, err: %v", c.vip, num, err)
 		}
-
 	}
-
 }
 
+// 边界测试 整数转ip
 func TestNumToVipBoundary(t *testing.T) {
-	var nums = [...]uint32{0, 1, 158, 567, 3005, 65533, 65534, 65535, 65536, 789789}
-	for index, num := range nums {
-		ip, err := NumToVip(num)
-		fmt.Printf("%v.整数 %v 转换为IP:%v\n", index, num, ip)
-		if err != nil {
-			fmt.Println(err)
+	pool := newTestPool(t, "10.11.0.0/16")
+	var cases = []struct {
+		num uint32
+		vip string
+	}{
+		{0, ""},
+		{1, ""},
+		{2, "10.11.0.2"},
+		{158, "10.11.0.158"},
+		{3005, "10.11.11.189"},
+		{65533, "10.11.255.253"},
+		{65534, ""},
+		{65535, ""},
+		{65536, ""},
+		{789789, ""},
+	}
+	for _, c := range cases {
+		vip, err := pool.NumToVip(c.num)
+		if vip != c.vip || (err == nil) != (c.vip != "") {
+			t.Errorf("整数 %v 转换为IP:%v, err: %v", c.num, vip, err)
 		}
 	}
-	fmt.Println("========[边界测试]========")
 }
 
-// 功能测试 ip转整数
-func TestTemp(t *testing.T) {
-	fmt.Println("！！！！！！！！！！！！！！！！！")
-	num, err := VipToNum("10.11.3.164")
+// 保留地址与网段校验
+func TestNewPool(t *testing.T) {
+	pool, err := NewPool(&PoolConfig{CIDR: "10.11.8.0/24", Reserved: 4})
 	if err != nil {
-		fmt.Println(err)
+		t.Fatal(err)
+	}
+	if min, max := pool.VipNumRange(); min != 5 || max != 253 {
+		t.Errorf("可分配范围:%v-%v", min, max)
+	}
+	if _, err := pool.NumToVip(4); err == nil {
+		t.Error("保留地址不应被分配")
+	}
+
+	for _, cidr := range []string{"", "10.11.0.0/15", "fd00::/64", "10.11.0", "10.11.0.0/31"} {
+		if _, err := NewPool(&PoolConfig{CIDR: cidr}); err == nil {
+			t.Errorf("网段 %q 应校验失败", cidr)
+		}
+	}
+	if _, err := NewPool(&PoolConfig{CIDR: "10.8.0.0/12", Topology: "net30"}); err != nil {
+		t.Errorf("net30 拓扑不限制掩码: %v", err)
 	}
-	fmt.Printf("IP转换为整数:%v\n", num)
 }
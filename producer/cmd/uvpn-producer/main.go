@@ -0,0 +1,239 @@
+/*
+UVPN 工单生产者命令行：
+工单可以来自命令行参数，也可以来自json文件或标准输入(单个json、json数组或每行一个json);
+
+	uvpn-producer -addr 192.168.5.119 -eid 1987 -name 王二小 -ip 10.16.3.0/24 -ip 192.168.5.9
+	uvpn-producer -config /opt/uvpn/conf.yaml -file orders.jsonl
+	cat orders.jsonl | uvpn-producer -addr 192.168.5.119 -file -
+	uvpn-producer -brokers 192.168.5.120:9092,192.168.5.121:9092 -file orders.jsonl
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mq/conf"
+	"mq/producer"
+	"mq/schema"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stringsFlag 可重复指定的参数
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func main() {
+	var ips, keys stringsFlag
+	configPath := flag.String("config", "", "消费者配置文件地址 从中读取 rocketMQ 或 kafka 连接信息")
+	addr := flag.String("addr", "", "RocketMQ 名称服务地址")
+	port := flag.String("port", "9876", "RocketMQ 名称服务端口")
+	brokers := flag.String("brokers", "", "Kafka broker 地址 多个以逗号分隔 指定后通过 Kafka 发送")
+	topic := flag.String("topic", producer.DefaultTopic, "工单主题")
+	tag := flag.String("tag", "", "消息tag 默认与主题同名")
+	flag.Var(&keys, "key", "附加的消息key 可重复指定")
+	retry := flag.Int("retry", producer.DefaultRetry, "发送失败重试次数")
+	delay := flag.Int("delay", 0, "延时级别 0为不延时")
+	async := flag.Bool("async", false, "异步发送")
+	file := flag.String("file", "", "从json文件读取工单 - 为标准输入")
+
+	spName := flag.String("sp", "UVPN权限", "工单名")
+	userid := flag.String("userid", "", "申请人id")
+	eid := flag.String("eid", "", "工号")
+	name := flag.String("name", "", "姓名")
+	operation := flag.String("op", schema.OperationGrant, "操作类型 grant/revoke/replace")
+	instance := flag.String("instance", "", "目标 OpenVPN 实例 为空时为默认实例")
+	flag.Var(&ips, "ip", "目标IP、CIDR或域名 可重复指定")
+	expire := flag.Duration("expire", 0, "权限有效期 如 720h 为0表示永久有效")
+	flag.Parse()
+
+	cfg := &producer.Config{Addr: *addr, Port: *port, Topic: *topic, Tag: *tag, Keys: keys, Retry: retry, DelayLevel: *delay}
+	if *brokers != "" {
+		cfg.Brokers = strings.Split(*brokers, ",")
+	}
+	// 先取配置文件中的连接信息 再以命令行中显式指定的参数覆盖
+	if *configPath != "" {
+		c, err := conf.Init(*configPath)
+		if err != nil {
+			exit(err)
+		}
+		cfg.Addr = c.RocketMQ.Addr
+		if c.RocketMQ.Port != "" {
+			cfg.Port = c.RocketMQ.Port
+		}
+		if c.RocketMQ.TopicName != "" {
+			cfg.Topic = c.RocketMQ.TopicName
+		}
+		if strings.EqualFold(c.Transport, "kafka") {
+			cfg.Brokers = c.Kafka.Brokers
+		}
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "addr":
+				cfg.Addr = *addr
+			case "port":
+				cfg.Port = *port
+			case "topic":
+				cfg.Topic = *topic
+			case "brokers":
+				cfg.Brokers = nil
+				if *brokers != "" {
+					cfg.Brokers = strings.Split(*brokers, ",")
+				}
+			}
+		})
+	}
+
+	var orders []*schema.UVPNAuthority
+	var err error
+	if *file != "" {
+		orders, err = readOrders(*file)
+	} else {
+		orders, err = flagOrder(*spName, *userid, *eid, *name, *operation, *instance, ips, *expire)
+	}
+	if err != nil {
+		exit(err)
+	}
+
+	client, err := producer.New(cfg)
+	if err != nil {
+		exit(err)
+	}
+	failed := sendOrders(client, orders, *async)
+	//关闭
+	if err = client.Shutdown(); err != nil {
+		fmt.Printf("shutdown producer error: %s\n", err.Error())
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// sendOrders 发送全部工单 返回失败的个数
+func sendOrders(client *producer.Client, orders []*schema.UVPNAuthority, async bool) (failed int) {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	report := func(order *schema.UVPNAuthority, msgId string, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if err != nil {
+			failed++
+			fmt.Printf("send message error: 工单名[%s] 工号[%s] %s\n", order.SpName, order.Eid, err)
+			return
+		}
+		fmt.Printf("send message success: 工单名[%s] 工号[%s] 消息Id[%s]\n", order.SpName, order.Eid, msgId)
+	}
+
+	for _, order := range orders {
+		order := order
+		if !async {
+			msgId, err := client.SendOrder(context.Background(), order)
+			report(order, msgId, err)
+			continue
+		}
+		wg.Add(1)
+		err := client.SendOrderAsync(context.Background(), order, func(msgId string, err error) {
+			defer wg.Done()
+			report(order, msgId, err)
+		})
+		if err != nil {
+			wg.Done()
+			report(order, "", err)
+		}
+	}
+	wg.Wait()
+	return
+}
+
+// flagOrder 由命令行参数构建工单
+func flagOrder(spName, userid, eid, name, operation, instance string, ips []string, expire time.Duration) ([]*schema.UVPNAuthority, error) {
+	if len(ips) == 0 && operation != schema.OperationReplace {
+		return nil, fmt.Errorf("至少指定一个 -ip")
+	}
+	order := &schema.UVPNAuthority{
+		SpName:      spName,
+		Userid:      userid,
+		Eid:         eid,
+		DisplayName: name,
+		Operation:   operation,
+		Instance:    instance,
+	}
+	if order.Userid == "" {
+		order.Userid = eid
+	}
+	var expireAt int64
+	if expire > 0 {
+		expireAt = time.Now().Add(expire).Unix()
+	}
+	for _, ip := range ips {
+		order.UVPNDestIps = append(order.UVPNDestIps, schema.UVPNDestIp{DestIp: ip, ExpireAt: expireAt})
+	}
+	return []*schema.UVPNAuthority{order}, nil
+}
+
+// readOrders 从文件或标准输入读取工单 支持单个json、json数组与每行一个json
+func readOrders(path string) (orders []*schema.UVPNAuthority, err error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	data = bytes.TrimSpace(data)
+
+	var raws []json.RawMessage
+	if bytes.HasPrefix(data, []byte("[")) {
+		if err = json.Unmarshal(data, &raws); err != nil {
+			return
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		for decoder.More() {
+			var raw json.RawMessage
+			if err = decoder.Decode(&raw); err != nil {
+				return
+			}
+			raws = append(raws, raw)
+		}
+	}
+
+	for idx, raw := range raws {
+		order, err := schema.Decode(raw)
+		if err != nil {
+			return nil, fmt.Errorf("第%d个工单格式错误: %v", idx+1, err)
+		}
+		orders = append(orders, order)
+	}
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("%s 中没有工单", path)
+	}
+	return
+}
+
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
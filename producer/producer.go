@@ -1,134 +1,201 @@
-package main
+/*
+UVPN 工单生产者：
+UUAP 等系统集成与运维命令行共用，发送前校验并规范化工单(域名解析为IP、CIDR 规范为网络地址、去重);
+命令行见 producer/cmd/uvpn-producer;
+*/
+package producer
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/apache/rocketmq-client-go/v2"
-	"github.com/apache/rocketmq-client-go/v2/primitive"
-	"github.com/apache/rocketmq-client-go/v2/producer"
-	log "github.com/sirupsen/logrus"
-	"mq/utils"
+	"mq/schema"
+	"mq/transport"
 	"net"
-	"os"
+	"strconv"
 	"strings"
 )
 
-var (
-	nameSrvAddr = "192.168.5.119"
-	nameSrvPort = "9876"
+const (
+	DefaultTopic = "UVPN"
+	DefaultRetry = 2
 )
 
-type UVPNAuthority struct {
-	SpName      string       `mapstructure:"spName"`
-	Userid      string       `mapstructure:"userid"`
-	Eid         string       `mapstructure:"工号"`
-	DisplayName string       `mapstructure:"姓名"`
-	UVPNDestIps []UVPNDestIp `mapstructure:"UVPN权限"`
+// Config 生产者配置
+type Config struct {
+	Addr       string   // RocketMQ 名称服务地址
+	Port       string   // RocketMQ 名称服务端口
+	Brokers    []string // Kafka broker 地址 配置后通过 Kafka 发送 不支持延时
+	Topic      string   // 工单主题 默认 UVPN
+	Tag        string   // 消息tag 默认与主题同名(消费者按主题名过滤tag)
+	Keys       []string // 附加的消息keys 工单名与工号总会作为keys
+	Retry      *int     // 发送失败重试次数 为nil时默认2 可以为0(不重试)
+	DelayLevel int      // 延时级别 0为不延时 共有18个级别 1s 5s 10s 30s 1m 2m 3m 4m 5m 6m 7m 8m 9m 10m 20m 30m 1h 2h
 }
 
-// UVPNDestIp UVPN目标权限
-type UVPNDestIp struct {
-	DestIp string `mapstructure:"目标IP"`
+// Client 工单生产者
+type Client struct {
+	cfg Config
+	t   transport.Transport
 }
 
-// RemoveRepeatedElement 通过map键的唯一性去重
-func RemoveRepeatedElement(s []UVPNDestIp) []UVPNDestIp {
-	result := make([]UVPNDestIp, 0)
-	m := make(map[UVPNDestIp]bool) //map的值不重要
-	for _, v := range s {
-		if _, ok := m[v]; !ok {
-			result = append(result, v)
-			m[v] = true
-		}
+// RejectedError 工单中有不合法的目标地址
+type RejectedError struct {
+	Rejected []*schema.ValidationError
+}
+
+func (e *RejectedError) Error() string {
+	var reasons []string
+	for _, r := range e.Rejected {
+		reasons = append(reasons, r.Error())
 	}
-	return result
+	return "工单中有不合法的目标地址: " + strings.Join(reasons, "; ")
 }
 
-func main() {
-	var order = UVPNAuthority{
-		SpName:      "UVPN权限",
-		Userid:      "1987",
-		Eid:         "1987",
-		DisplayName: "王二小",
-		UVPNDestIps: []UVPNDestIp{
-			{DestIp: "10.16.3.0/24"},
-			{DestIp: "192.168.5.9"},
-			{DestIp: "192.168.5.9"},
-			{DestIp: "192.168.5.8"},
-			{DestIp: "122.112.146.97"},
-			{DestIp: "122.112.146.97"},
-			{DestIp: "12.4.3"}, // 这个填写少了 但是错误没判断出来 转换成了12.4.0.3
-		},
+// New 新建并启动工单生产者
+func New(c *Config) (*Client, error) {
+	cfg := *c
+	if len(cfg.Brokers) == 0 && (cfg.Addr == "" || cfg.Port == "") {
+		return nil, errors.New("RocketMQ 名称服务地址不可为空!")
+	}
+	if len(cfg.Brokers) > 0 && cfg.DelayLevel > 0 {
+		return nil, errors.New("Kafka 不支持延时发送!")
+	}
+	if cfg.Topic == "" {
+		cfg.Topic = DefaultTopic
+	}
+	if cfg.Tag == "" {
+		cfg.Tag = cfg.Topic
+	}
+	retry, err := retries(&cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	// 复制工单
-	tmpOrder := order
-	tmpOrder.UVPNDestIps = []UVPNDestIp{}
-
-	for _, item := range order.UVPNDestIps {
-		ip := net.ParseIP(item.DestIp)
-		if ip == nil { // 如果不是IP地址，判断是否是域名
-			dnsIp, err := utils.ResolveIP(item.DestIp) // 将域名解析
-			if err != nil {
-				if dnsIp == "" && !strings.Contains(item.DestIp, "/") {
-					log.Warning("[域名解析不出来，告知用户错误了]", item.DestIp)
-				} else {
-					cidr, ci, _ := net.ParseCIDR(item.DestIp)
-					log.Info("[CIDR]", cidr, ci)
-					tmpOrder.UVPNDestIps = append(tmpOrder.UVPNDestIps, UVPNDestIp{ci.String()})
-				}
-			} else {
-				log.Info("[域名IP]", dnsIp)
-				tmpOrder.UVPNDestIps = append(tmpOrder.UVPNDestIps, UVPNDestIp{dnsIp})
-			}
-		} else {
-			if utils.IsPublicIP(ip) {
-				log.Warning("[公网IP] 企业微信告知用户，只处理内网地址", ip)
-			} else {
-				log.Info("[正常IP]", ip)
-				tmpOrder.UVPNDestIps = append(tmpOrder.UVPNDestIps, UVPNDestIp{ip.String()})
-			}
-		}
+	var t transport.Transport
+	if len(cfg.Brokers) > 0 {
+		t, err = transport.NewKafka(&transport.KafkaConfig{Brokers: cfg.Brokers})
+	} else {
+		t, err = transport.NewRocketMQ(&transport.RocketMQConfig{
+			NameSrvAddrs: []string{cfg.Addr + ":" + cfg.Port},
+			//指定重试次数
+			Retry: retry,
+		})
+	}
+	if err != nil {
+		return nil, err
 	}
+	// 启动producer
+	if err = t.Start(); err != nil {
+		return nil, fmt.Errorf("start producer error: %v", err)
+	}
+	return &Client{cfg: cfg, t: t}, nil
+}
 
-	tmpOrder.UVPNDestIps = RemoveRepeatedElement(tmpOrder.UVPNDestIps)
+// retries 发送失败重试次数 未设置时为 DefaultRetry
+func retries(c *Config) (int, error) {
+	if c.Retry == nil {
+		return DefaultRetry, nil
+	}
+	if *c.Retry < 0 {
+		return 0, fmt.Errorf("重试次数不可为负数: %d", *c.Retry)
+	}
+	return *c.Retry, nil
+}
 
-	p, _ := rocketmq.NewProducer(
-		producer.WithNsResolver(primitive.NewPassthroughResolver([]string{nameSrvAddr + ":" + nameSrvPort})),
-		//指定重试次数
-		producer.WithRetry(2),
-	)
-	// 启动producer
-	err := p.Start()
+// Shutdown 关闭生产者
+func (c *Client) Shutdown() error {
+	return c.t.Shutdown()
+}
+
+// SendOrder 校验并同步发送工单 返回消息Id; 有不合法的目标地址时返回 *RejectedError 且不发送
+func (c *Client) SendOrder(ctx context.Context, order *schema.UVPNAuthority) (msgId string, err error) {
+	msg, err := c.newMessage(order)
 	if err != nil {
-		fmt.Printf("start producer error: %s", err.Error())
-		os.Exit(1)
+		return
 	}
-	topic := "UVPN"
-	data, err := json.Marshal(tmpOrder)
-	msg := &primitive.Message{
-		Topic: topic,
-		Body:  data,
+	msgId, err = c.t.Publish(ctx, msg)
+	if err != nil {
+		return "", fmt.Errorf("send message error: %v", err)
 	}
-	//指定标签
-	msg.WithTag("UVPN")
-	msg.WithKeys([]string{"UVPN", "权限"})
-	msg.WithProperty("属性", "权限")
-	//参数是延时级别，共有16个级别 1s 5s 10s 30s 1m 2m 3m 4m 5m 6m 7m 8m 9m 10m 20m 30m 1h 2h
-	msg.WithDelayTimeLevel(3)
+	return msgId, nil
+}
 
-	res, err := p.SendSync(context.Background(), msg)
+// SendOrderAsync 校验并异步发送工单 发送结果通过 callback 返回
+func (c *Client) SendOrderAsync(ctx context.Context, order *schema.UVPNAuthority, callback func(msgId string, err error)) error {
+	msg, err := c.newMessage(order)
+	if err != nil {
+		return err
+	}
+	go func() {
+		msgId, err := c.t.Publish(ctx, msg)
+		if err != nil {
+			callback("", fmt.Errorf("send message error: %v", err))
+			return
+		}
+		callback(msgId, nil)
+	}()
+	return nil
+}
 
+// newMessage 规范化工单并构建消息
+func (c *Client) newMessage(order *schema.UVPNAuthority) (*transport.Message, error) {
+	normalized, rejected, err := NormalizeOrder(order)
 	if err != nil {
-		fmt.Printf("send message error: %s\n", err)
-	} else {
-		fmt.Printf("send message success: result=%s\n", res.String())
-		fmt.Println(res.MsgID)
+		return nil, err
 	}
-	//关闭
-	err = p.Shutdown()
+	if len(rejected) > 0 {
+		return nil, &RejectedError{Rejected: rejected}
+	}
+	data, err := schema.Encode(normalized)
 	if err != nil {
-		fmt.Printf("shutdown producer error: %s", err.Error())
+		return nil, err
 	}
+
+	msg := &transport.Message{
+		Topic: c.cfg.Topic,
+		//指定标签
+		Tag:  c.cfg.Tag,
+		Keys: append([]string{order.SpName, order.Eid}, c.cfg.Keys...),
+		Body: data,
+	}
+	if c.cfg.DelayLevel > 0 {
+		msg.WithProperty(transport.PropertyDelayLevel, strconv.Itoa(c.cfg.DelayLevel))
+	}
+	return msg, nil
+}
+
+// NormalizeOrder 校验并规范化工单 返回只含合法目标地址的工单副本与被拒绝的目标地址
+// 合法的目标地址规范为IP(主机路由)或CIDR 域名解析为IP 重复的目标地址去重
+func NormalizeOrder(order *schema.UVPNAuthority) (normalized *schema.UVPNAuthority, rejected []*schema.ValidationError, err error) {
+	dests, rejected, err := schema.ValidateOrder(order)
+	if err != nil {
+		return
+	}
+
+	// 复制工单
+	tmpOrder := *order
+	tmpOrder.UVPNDestIps = []schema.UVPNDestIp{}
+	for _, dest := range dests {
+		destIp := dest.Route.Network
+		if ones, _ := net.IPMask(net.ParseIP(dest.Route.Netmask).To4()).Size(); ones != 32 {
+			destIp = fmt.Sprintf("%s/%d", dest.Route.Network, ones)
+		}
+		tmpOrder.UVPNDestIps = append(tmpOrder.UVPNDestIps, schema.UVPNDestIp{DestIp: destIp, ExpireAt: dest.ExpireAt})
+	}
+	tmpOrder.UVPNDestIps = RemoveRepeatedElement(tmpOrder.UVPNDestIps)
+	return &tmpOrder, rejected, nil
+}
+
+// RemoveRepeatedElement 通过map键的唯一性去重
+func RemoveRepeatedElement(s []schema.UVPNDestIp) []schema.UVPNDestIp {
+	result := make([]schema.UVPNDestIp, 0)
+	m := make(map[schema.UVPNDestIp]bool) //map的值不重要
+	for _, v := range s {
+		if _, ok := m[v]; !ok {
+			result = append(result, v)
+			m[v] = true
+		}
+	}
+	return result
 }
@@ -0,0 +1,59 @@
+package producer
+
+import (
+	"mq/schema"
+	"reflect"
+	"testing"
+)
+
+// 规范化工单 CIDR 取网络地址、去重、拒绝公网与格式错误的地址
+func TestNormalizeOrder(t *testing.T) {
+	order := &schema.UVPNAuthority{
+		SpName:      "UVPN权限",
+		Eid:         "1987",
+		DisplayName: "王二小",
+		UVPNDestIps: []schema.UVPNDestIp{
+			{DestIp: "10.16.3.7/24"},
+			{DestIp: "192.168.5.9"},
+			{DestIp: "192.168.5.9"},
+			{DestIp: "192.168.5.8", ExpireAt: 1893427200},
+			{DestIp: "122.112.146.97"},
+			{DestIp: "12.4.3"}, // 这个填写少了 不能被解析成12.4.0.3
+		},
+	}
+	normalized, rejected, err := NormalizeOrder(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []schema.UVPNDestIp{
+		{DestIp: "10.16.3.0/24"},
+		{DestIp: "192.168.5.9"},
+		{DestIp: "192.168.5.8", ExpireAt: 1893427200},
+	}
+	if !reflect.DeepEqual(normalized.UVPNDestIps, want) {
+		t.Errorf("UVPNDestIps = %v", normalized.UVPNDestIps)
+	}
+	if len(rejected) != 2 {
+		t.Errorf("rejected = %v", rejected)
+	}
+	if len(order.UVPNDestIps) != 6 {
+		t.Error("原工单不应被修改")
+	}
+}
+
+// 未设置时默认重试2次 可以设为0 不可为负数
+func TestRetries(t *testing.T) {
+	zero, three, negative := 0, 3, -1
+	for _, c := range []struct {
+		retry *int
+		want  int
+	}{{nil, DefaultRetry}, {&zero, 0}, {&three, 3}} {
+		if got, err := retries(&Config{Retry: c.retry}); err != nil || got != c.want {
+			t.Errorf("retries(%v) = %d, %v, want %d", c.retry, got, err, c.want)
+		}
+	}
+	if _, err := retries(&Config{Retry: &negative}); err == nil {
+		t.Error("重试次数为负数时应返回错误")
+	}
+}
@@ -0,0 +1,116 @@
+/*
+UVPN 工单消息格式 生产者与消费者共用：
+消息体为json 字段名见各字段的json标签 version 为消息格式版本;
+兼容解码不带 version 的旧消息(字段名为Go结构体字段名 如 SpName、UVPNDestIps、DestIp);
+不带 version 但使用新字段名 destIps 的消息按当前格式解码;
+*/
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Version 当前消息格式版本
+const Version = 1
+
+// 工单操作类型
+const (
+	OperationGrant   = "grant"   // 授权 追加路由 为空时默认
+	OperationRevoke  = "revoke"  // 回收 删除工单中的路由
+	OperationReplace = "replace" // 替换 用工单中的路由覆盖用户全部路由
+)
+
+// UVPNAuthority UVPN权限工单
+type UVPNAuthority struct {
+	Version     int          `json:"version"`             // 消息格式版本
+	SpName      string       `json:"spName"`              // 工单名
+	Userid      string       `json:"userid"`              // 申请人id
+	Eid         string       `json:"eid"`                 // 工号
+	DisplayName string       `json:"displayName"`         // 姓名
+	Operation   string       `json:"operation,omitempty"` // grant/revoke/replace 为空时为grant
+	Instance    string       `json:"instance,omitempty"`  // 目标 OpenVPN 实例 为空时为默认实例
+	UVPNDestIps []UVPNDestIp `json:"destIps"`             // UVPN权限
+}
+
+// UVPNDestIp UVPN目标权限
+type UVPNDestIp struct {
+	DestIp   string `json:"destIp"`             // 目标IP、CIDR或域名
+	ExpireAt int64  `json:"expireAt,omitempty"` // 过期时间戳(秒) 为0表示永久有效
+}
+
+// legacyAuthority 不带 version 的旧消息 字段名为Go结构体字段名
+type legacyAuthority struct {
+	SpName      string `json:"SpName"`
+	Userid      string `json:"Userid"`
+	Eid         string `json:"Eid"`
+	DisplayName string `json:"DisplayName"`
+	Operation   string `json:"Operation"`
+	Instance    string `json:"Instance"`
+	UVPNDestIps []struct {
+		DestIp   string `json:"DestIp"`
+		ExpireAt int64  `json:"ExpireAt"`
+	} `json:"UVPNDestIps"`
+}
+
+// Encode 编码工单 未设置版本时写入当前版本
+func Encode(order *UVPNAuthority) ([]byte, error) {
+	o := *order
+	if o.Version == 0 {
+		o.Version = Version
+	}
+	return json.Marshal(&o)
+}
+
+// Decode 解码工单 兼容不带 version 的旧消息; 未指定操作类型时为 grant
+func Decode(data []byte) (order *UVPNAuthority, err error) {
+	// json 字段名大小写不敏感 其余字段新旧格式都能匹配 只有目标权限的字段名不同
+	var probe struct {
+		Version int             `json:"version"`
+		DestIps json.RawMessage `json:"destIps"`
+	}
+	if err = json.Unmarshal(data, &probe); err != nil {
+		return
+	}
+
+	switch {
+	case probe.Version == 0 && probe.DestIps == nil:
+		var legacy legacyAuthority
+		if err = json.Unmarshal(data, &legacy); err != nil {
+			return
+		}
+		order = &UVPNAuthority{
+			Version:     Version,
+			SpName:      legacy.SpName,
+			Userid:      legacy.Userid,
+			Eid:         legacy.Eid,
+			DisplayName: legacy.DisplayName,
+			Operation:   legacy.Operation,
+			Instance:    legacy.Instance,
+		}
+		for _, destIp := range legacy.UVPNDestIps {
+			order.UVPNDestIps = append(order.UVPNDestIps, UVPNDestIp{DestIp: destIp.DestIp, ExpireAt: destIp.ExpireAt})
+		}
+	case probe.Version <= Version:
+		order = &UVPNAuthority{}
+		if err = json.Unmarshal(data, order); err != nil {
+			return nil, err
+		}
+		order.Version = Version
+	default:
+		return nil, fmt.Errorf("不支持的消息格式版本: %d", probe.Version)
+	}
+
+	if order.Operation == "" {
+		order.Operation = OperationGrant
+	}
+	return
+}
+
+// DestIps 工单中的全部目标地址
+func (order *UVPNAuthority) DestIps() (ips []string) {
+	for _, destIp := range order.UVPNDestIps {
+		ips = append(ips, destIp.DestIp)
+	}
+	return
+}
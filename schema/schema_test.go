@@ -0,0 +1,110 @@
+package schema
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "更新 testdata 下的 golden 文件")
+
+// sampleOrder 与 testdata/v1.golden.json 对应的工单
+var sampleOrder = UVPNAuthority{
+	Version:     Version,
+	SpName:      "UVPN权限",
+	Userid:      "1987",
+	Eid:         "1987",
+	DisplayName: "王二小",
+	Operation:   OperationGrant,
+	Instance:    "udp",
+	UVPNDestIps: []UVPNDestIp{
+		{DestIp: "10.16.3.0/24"},
+		{DestIp: "192.168.5.8", ExpireAt: 1893427200},
+	},
+}
+
+func readGolden(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.TrimSpace(data)
+}
+
+// 编码结果与 golden 文件一致 消息格式变更时需同步升级 Version
+func TestEncodeGolden(t *testing.T) {
+	data, err := Encode(&sampleOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "v1.golden.json")
+	if *update {
+		if err := ioutil.WriteFile(golden, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := readGolden(t, "v1.golden.json"); !bytes.Equal(data, want) {
+		t.Errorf("wire format changed:\ngot  %s\nwant %s", data, want)
+	}
+}
+
+// 解码各版本消息
+func TestDecodeGolden(t *testing.T) {
+	legacy := UVPNAuthority{
+		Version:     Version,
+		SpName:      "UVPN权限",
+		Userid:      "1987",
+		Eid:         "1987",
+		DisplayName: "王二小",
+		Operation:   OperationGrant,
+		UVPNDestIps: []UVPNDestIp{{DestIp: "10.16.3.0/24"}, {DestIp: "192.168.5.9"}},
+	}
+	legacyRevoke := legacy
+	legacyRevoke.Operation, legacyRevoke.Instance = OperationRevoke, "tcp"
+	legacyRevoke.UVPNDestIps = []UVPNDestIp{{DestIp: "192.168.5.8", ExpireAt: 1893427200}}
+
+	var cases = []struct {
+		file string
+		want UVPNAuthority
+	}{
+		{"v1.golden.json", sampleOrder},
+		{"v0.legacy.json", legacy},
+		{"v0.legacy_revoke.json", legacyRevoke},
+	}
+	for _, c := range cases {
+		order, err := Decode(readGolden(t, c.file))
+		if err != nil {
+			t.Errorf("%s: %v", c.file, err)
+			continue
+		}
+		if !reflect.DeepEqual(*order, c.want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", c.file, *order, c.want)
+		}
+	}
+}
+
+// 不带 version 但使用新字段名的消息不丢失目标权限
+func TestDecodeUnversioned(t *testing.T) {
+	data := `{"spName":"UVPN权限","eid":"1987","displayName":"王二小","destIps":[{"destIp":"10.16.3.0/24","expireAt":1893427200}]}`
+	order, err := Decode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := UVPNAuthority{Version: Version, SpName: "UVPN权限", Eid: "1987", DisplayName: "王二小", Operation: OperationGrant,
+		UVPNDestIps: []UVPNDestIp{{DestIp: "10.16.3.0/24", ExpireAt: 1893427200}}}
+	if !reflect.DeepEqual(*order, want) {
+		t.Errorf("got  %+v\nwant %+v", *order, want)
+	}
+}
+
+// 不支持的版本与非法json
+func TestDecodeError(t *testing.T) {
+	for _, data := range []string{`{"version":99,"spName":"UVPN权限"}`, `{"SpName":`, `[]`} {
+		if _, err := Decode([]byte(data)); err == nil {
+			t.Errorf("Decode(%s) should fail", data)
+		}
+	}
+}
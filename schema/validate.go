@@ -0,0 +1,165 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"mq/ccd"
+	"mq/utils"
+	"net"
+	"strings"
+)
+
+// RejectReason 校验失败的原因
+type RejectReason string
+
+const (
+	RejectRequired     RejectReason = "必填字段为空"
+	RejectUnknownOp    RejectReason = "未知的工单操作类型"
+	RejectInvalidAddr  RejectReason = "不是合法的IPv4地址、CIDR或域名"
+	RejectUnresolvable RejectReason = "域名无法解析为IPv4地址"
+	RejectPublicAddr   RejectReason = "只处理内网地址"
+	RejectReservedAddr RejectReason = "不可授权的保留地址"
+)
+
+// ValidationError 工单字段校验失败
+type ValidationError struct {
+	Field  string       `json:"field"`  // 字段 如 UVPNDestIps[2].DestIp
+	Value  string       `json:"value"`  // 字段值
+	Reason RejectReason `json:"reason"` // 原因
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s[%s] %s", e.Field, e.Value, e.Reason)
+}
+
+// ResolveError 域名解析暂时失败(DNS 超时、服务不可用等) 稍后重试可能成功 不是目标地址本身的问题
+type ResolveError struct {
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("%s[%s] 域名解析失败: %v", e.Field, e.Value, e.Err)
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+// resolveIP 域名解析 测试时替换
+var resolveIP = utils.ResolveIP
+
+// ValidatedDest 校验通过的目标地址
+type ValidatedDest struct {
+	UVPNDestIp
+	Route ccd.Route
+}
+
+// ValidateOrder 校验工单
+// 工单级别的字段不合法或没有目标地址时返回错误; 目标地址逐个校验，不合法的目标地址在 rejected 中返回
+// 域名解析暂时失败时返回 *ResolveError 整个工单应稍后重试
+func ValidateOrder(order *UVPNAuthority) (dests []ValidatedDest, rejected []*ValidationError, err error) {
+	switch order.Operation {
+	case "", OperationGrant, OperationRevoke, OperationReplace:
+	default:
+		return nil, nil, &ValidationError{Field: "Operation", Value: order.Operation, Reason: RejectUnknownOp}
+	}
+	if strings.TrimSpace(order.Eid) == "" {
+		return nil, nil, &ValidationError{Field: "Eid", Value: order.Eid, Reason: RejectRequired}
+	}
+	if strings.TrimSpace(order.DisplayName) == "" {
+		return nil, nil, &ValidationError{Field: "DisplayName", Value: order.DisplayName, Reason: RejectRequired}
+	}
+	// 没有目标地址时替换会清空用户全部路由 授权也只会新建ccd文件、分配VIP 删除用户应使用 delete-user
+	if len(order.UVPNDestIps) == 0 {
+		return nil, nil, &ValidationError{Field: "UVPNDestIps", Reason: RejectRequired}
+	}
+
+	for idx, destIp := range order.UVPNDestIps {
+		field := fmt.Sprintf("UVPNDestIps[%d].DestIp", idx)
+		route, reason, err := ValidateDestIp(strings.TrimSpace(destIp.DestIp))
+		if err != nil {
+			return nil, nil, &ResolveError{Field: field, Value: destIp.DestIp, Err: err}
+		}
+		if reason != "" {
+			rejected = append(rejected, &ValidationError{Field: field, Value: destIp.DestIp, Reason: reason})
+			continue
+		}
+		dests = append(dests, ValidatedDest{UVPNDestIp: destIp, Route: route})
+	}
+	return
+}
+
+// ValidateDestIp 校验目标地址并转换为ovpn的路由 目标地址可以是IPv4地址、CIDR或可解析的域名，且只能是内网地址
+// 域名不存在时拒绝; 解析暂时失败时返回错误
+func ValidateDestIp(destIp string) (route ccd.Route, reason RejectReason, err error) {
+	if destIp == "" {
+		return route, RejectRequired, nil
+	}
+
+	var first, last net.IP
+	mask := net.CIDRMask(32, 32)
+	switch {
+	case strings.Contains(destIp, "/"): // CIDR 则生成子网掩码
+		_, ipv4Net, err := net.ParseCIDR(destIp)
+		if err != nil || ipv4Net.IP.To4() == nil {
+			return route, RejectInvalidAddr, nil
+		}
+		first, mask = ipv4Net.IP.To4(), ipv4Net.Mask
+		last = make(net.IP, len(first))
+		for i := range first {
+			last[i] = first[i] | ^mask[i]
+		}
+	case net.ParseIP(destIp) != nil: // IP
+		if first = net.ParseIP(destIp).To4(); first == nil {
+			return route, RejectInvalidAddr, nil
+		}
+	default: // 域名
+		if !isHostname(destIp) {
+			return route, RejectInvalidAddr, nil
+		}
+		dnsIp, err := resolveIP(destIp) // 将域名解析
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && !dnsErr.IsNotFound {
+			return route, "", err
+		}
+		if err != nil {
+			return route, RejectUnresolvable, nil
+		}
+		if first = net.ParseIP(dnsIp).To4(); first == nil {
+			return route, RejectUnresolvable, nil
+		}
+	}
+	if last == nil {
+		last = first
+	}
+
+	// 链路本地地址(169.254.0.0/16)只在本网段有效 不能路由
+	if first.IsUnspecified() || first.IsLoopback() || first.IsMulticast() || last.IsMulticast() ||
+		first.IsLinkLocalUnicast() || last.IsLinkLocalUnicast() {
+		return route, RejectReservedAddr, nil
+	}
+	if utils.IsPublicIP(first) || utils.IsPublicIP(last) {
+		return route, RejectPublicAddr, nil
+	}
+	return ccd.Route{Network: first.String(), Netmask: utils.Ipv4MaskString(mask)}, "", nil
+}
+
+// isHostname 是否为合法域名 纯数字与点组成的(如 12.4.3)不视为域名，避免被解析器补全为 12.4.0.3
+func isHostname(s string) bool {
+	if len(s) > 253 || strings.Trim(s, "0123456789.") == "" {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
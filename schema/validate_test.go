@@ -0,0 +1,110 @@
+package schema
+
+import (
+	"errors"
+	"mq/ccd"
+	"mq/utils"
+	"net"
+	"testing"
+)
+
+// 目标地址校验 不涉及域名解析
+func TestValidateDestIp(t *testing.T) {
+	var cases = []struct {
+		destIp string
+		route  ccd.Route
+		reason RejectReason
+	}{
+		{"192.168.5.9", ccd.Route{Network: "192.168.5.9", Netmask: "255.255.255.255"}, ""},
+		{"10.16.3.0/24", ccd.Route{Network: "10.16.3.0", Netmask: "255.255.255.0"}, ""},
+		{"10.16.3.7/24", ccd.Route{Network: "10.16.3.0", Netmask: "255.255.255.0"}, ""},
+		{"", ccd.Route{}, RejectRequired},
+		{"12.4.3", ccd.Route{}, RejectInvalidAddr},
+		{"10.16.3.0/33", ccd.Route{}, RejectInvalidAddr},
+		{"fd00::1", ccd.Route{}, RejectInvalidAddr},
+		{"under_score.local", ccd.Route{}, RejectInvalidAddr},
+		{"122.112.146.97", ccd.Route{}, RejectPublicAddr},
+		{"10.0.0.0/7", ccd.Route{}, RejectPublicAddr},
+		{"0.0.0.0/0", ccd.Route{}, RejectReservedAddr},
+		{"127.0.0.1", ccd.Route{}, RejectReservedAddr},
+		{"169.254.169.254", ccd.Route{}, RejectReservedAddr},
+		{"169.254.0.0/16", ccd.Route{}, RejectReservedAddr},
+	}
+	for _, c := range cases {
+		route, reason, err := ValidateDestIp(c.destIp)
+		if route != c.route || reason != c.reason || err != nil {
+			t.Errorf("ValidateDestIp(%q) = %v, %q, %v", c.destIp, route, reason, err)
+		}
+	}
+}
+
+// 域名不存在时拒绝 解析暂时失败时整个工单返回错误以便重试
+func TestValidateResolve(t *testing.T) {
+	resolveIP = func(domain string) (string, error) {
+		switch domain {
+		case "git.example.com":
+			return "10.16.3.7", nil
+		case "missing.example.com":
+			return "", &net.DNSError{Err: "no such host", Name: domain, IsNotFound: true}
+		}
+		return "", &net.DNSError{Err: "i/o timeout", Name: domain, IsTimeout: true}
+	}
+	defer func() { resolveIP = utils.ResolveIP }()
+
+	if route, reason, err := ValidateDestIp("git.example.com"); err != nil || reason != "" || route.Network != "10.16.3.7" {
+		t.Errorf("resolvable = %v, %q, %v", route, reason, err)
+	}
+	if _, reason, err := ValidateDestIp("missing.example.com"); err != nil || reason != RejectUnresolvable {
+		t.Errorf("NXDOMAIN = %q, %v", reason, err)
+	}
+	if _, reason, err := ValidateDestIp("slow.example.com"); err == nil || reason != "" {
+		t.Errorf("timeout = %q, %v", reason, err)
+	}
+
+	order := &UVPNAuthority{Eid: "1987", DisplayName: "王二小", UVPNDestIps: []UVPNDestIp{{DestIp: "10.16.3.0/24"}, {DestIp: "slow.example.com"}}}
+	_, _, err := ValidateOrder(order)
+	var resolveErr *ResolveError
+	if !errors.As(err, &resolveErr) || resolveErr.Field != "UVPNDestIps[1].DestIp" {
+		t.Errorf("ValidateOrder() err = %v", err)
+	}
+}
+
+// 工单校验 逐个拒绝不合法的目标地址
+func TestValidateOrder(t *testing.T) {
+	order := &UVPNAuthority{
+		Eid:         "1987",
+		DisplayName: "王二小",
+		UVPNDestIps: []UVPNDestIp{{DestIp: "10.16.3.0/24", ExpireAt: 1700000000}, {DestIp: "12.4.3"}},
+	}
+	dests, rejected, err := ValidateOrder(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dests) != 1 || dests[0].ExpireAt != 1700000000 {
+		t.Errorf("dests = %v", dests)
+	}
+	if len(rejected) != 1 || rejected[0].Field != "UVPNDestIps[1].DestIp" || rejected[0].Reason != RejectInvalidAddr {
+		t.Errorf("rejected = %v", rejected)
+	}
+
+	for _, op := range []string{OperationGrant, OperationRevoke, OperationReplace} {
+		empty := &UVPNAuthority{Eid: "1987", DisplayName: "王二小", Operation: op}
+		_, _, err := ValidateOrder(empty)
+		if ve, ok := err.(*ValidationError); !ok || ve.Field != "UVPNDestIps" || ve.Reason != RejectRequired {
+			t.Errorf("%s 没有目标地址: %v", op, err)
+		}
+		empty.UVPNDestIps = []UVPNDestIp{}
+		if _, _, err = ValidateOrder(empty); err == nil {
+			t.Errorf("%s 目标地址为空列表应校验失败", op)
+		}
+	}
+
+	order.Operation = "delete"
+	if _, _, err := ValidateOrder(order); err == nil {
+		t.Error("未知的操作类型应校验失败")
+	}
+	order.Operation, order.Eid = OperationRevoke, ""
+	if _, _, err := ValidateOrder(order); err == nil {
+		t.Error("缺少工号应校验失败")
+	}
+}
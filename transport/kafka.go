@@ -0,0 +1,228 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultKafkaRetryDelay = 5 * time.Second // 默认重试间隔
+
+	// Kafka 没有tag、keys与消息Id 通过消息头传递
+	headerTag   = "TAG"
+	headerKeys  = "KEYS" // json 数组 key 中可以有空格
+	headerMsgId = "MSG_ID"
+)
+
+// KafkaConfig Kafka 传输配置
+type KafkaConfig struct {
+	Brokers        []string      // broker 地址 ip:port
+	GroupID        string        // 消费组
+	StartFromFirst bool          // 新消费组从最早的消息开始消费
+	RetryDelay     time.Duration // 返回 Retry 后重新处理的间隔 默认5秒
+}
+
+// Kafka 基于 Kafka 的消息传输
+// Kafka 按分区顺序提交位点 无法单独重投某条消息 返回 Retry 时在进程内间隔 RetryDelay 重新处理
+// 处理成功(返回 Ack)后才提交位点 进程退出时未确认的消息在重启后重新投递
+type Kafka struct {
+	cfg    KafkaConfig
+	writer *kafka.Writer
+	subs   []*kafkaSub
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type kafkaSub struct {
+	tag     string
+	handler Handler
+	reader  kafkaReader
+}
+
+// kafkaReader 消费组的读取与提交 即 *kafka.Reader 用到的方法
+type kafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// NewKafka 新建 Kafka 传输
+func NewKafka(c *KafkaConfig) (*Kafka, error) {
+	if len(c.Brokers) == 0 {
+		return nil, errors.New("Kafka broker 地址不可为空!")
+	}
+	cfg := *c
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultKafkaRetryDelay
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Kafka{
+		cfg: cfg,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 10 * time.Millisecond,
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+// Subscribe 订阅主题
+func (k *Kafka) Subscribe(topic, tag string, h Handler) error {
+	if k.cfg.GroupID == "" {
+		return errors.New("Kafka 消费组不可为空!")
+	}
+	startOffset := kafka.LastOffset
+	if k.cfg.StartFromFirst {
+		startOffset = kafka.FirstOffset
+	}
+	k.subs = append(k.subs, &kafkaSub{
+		tag:     tag,
+		handler: h,
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     k.cfg.Brokers,
+			GroupID:     k.cfg.GroupID,
+			Topic:       topic,
+			StartOffset: startOffset,
+			MaxWait:     time.Second,
+		}),
+	})
+	return nil
+}
+
+// Publish 同步发布消息 消息Id由生产者生成并放在消息头中
+func (k *Kafka) Publish(ctx context.Context, msg *Message) (string, error) {
+	km, msgId, err := toKafkaMessage(msg)
+	if err != nil {
+		return "", err
+	}
+	if err = k.writer.WriteMessages(ctx, km); err != nil {
+		return "", err
+	}
+	return msgId, nil
+}
+
+// Start 为每个订阅启动消费协程
+func (k *Kafka) Start() error {
+	for _, sub := range k.subs {
+		k.wg.Add(1)
+		go k.consume(sub)
+	}
+	return nil
+}
+
+// consume 逐条处理消息 确认后提交位点
+// 拉取失败(broker 或网络故障)时间隔 RetryDelay 重试 直到 Shutdown
+func (k *Kafka) consume(sub *kafkaSub) {
+	defer k.wg.Done()
+	for {
+		km, err := sub.reader.FetchMessage(k.ctx)
+		if err != nil {
+			if k.ctx.Err() != nil {
+				return
+			}
+			log.Error("Fail to fetch kafka message, err: ", err)
+			select {
+			case <-k.ctx.Done():
+				return
+			case <-time.After(k.cfg.RetryDelay):
+			}
+			continue
+		}
+
+		msg := fromKafkaMessage(km)
+		if sub.tag == "" || sub.tag == "*" || msg.Tag == sub.tag {
+			for sub.handler(k.ctx, msg) == Retry {
+				select {
+				case <-k.ctx.Done():
+					return
+				case <-time.After(k.cfg.RetryDelay):
+				}
+				msg.Attempts++
+			}
+		}
+		if err = sub.reader.CommitMessages(k.ctx, km); err != nil && k.ctx.Err() == nil {
+			log.Error(fmt.Sprintf("Fail to commit kafka offset %s, err: %v", msg.Id, err))
+		}
+	}
+}
+
+// Shutdown 停止消费并关闭连接
+func (k *Kafka) Shutdown() (err error) {
+	k.cancel()
+	k.wg.Wait()
+	for _, sub := range k.subs {
+		if cerr := sub.reader.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if werr := k.writer.Close(); err == nil {
+		err = werr
+	}
+	return
+}
+
+// toKafkaMessage 转换为 Kafka 消息 第一个key作为分区键
+func toKafkaMessage(msg *Message) (km kafka.Message, msgId string, err error) {
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return
+	}
+	msgId = hex.EncodeToString(id)
+	keys, err := json.Marshal(msg.Keys)
+	if err != nil {
+		return
+	}
+
+	km = kafka.Message{Topic: msg.Topic, Value: msg.Body}
+	if len(msg.Keys) > 0 {
+		km.Key = []byte(msg.Keys[0])
+	}
+	km.Headers = append(km.Headers,
+		kafka.Header{Key: headerMsgId, Value: []byte(msgId)},
+		kafka.Header{Key: headerTag, Value: []byte(msg.Tag)},
+		kafka.Header{Key: headerKeys, Value: keys},
+	)
+	for key, value := range msg.Properties {
+		km.Headers = append(km.Headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	return
+}
+
+// fromKafkaMessage 转换为传输层消息 没有消息Id时以 主题-分区@位点 作为消息Id
+func fromKafkaMessage(km kafka.Message) *Message {
+	msg := &Message{
+		Id:       fmt.Sprintf("%s-%d@%d", km.Topic, km.Partition, km.Offset),
+		Topic:    km.Topic,
+		Body:     km.Value,
+		StoredAt: km.Time,
+	}
+	for _, h := range km.Headers {
+		switch h.Key {
+		case headerMsgId:
+			msg.Id = string(h.Value)
+		case headerTag:
+			msg.Tag = string(h.Value)
+		case headerKeys:
+			// 兼容以空格分隔的旧消息头
+			if json.Unmarshal(h.Value, &msg.Keys) != nil {
+				msg.Keys = strings.Fields(string(h.Value))
+			}
+		default:
+			msg.WithProperty(h.Key, string(h.Value))
+		}
+	}
+	return msg
+}
@@ -0,0 +1,166 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"github.com/segmentio/kafka-go"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tag、keys、属性与消息Id通过消息头往返 key 中可以有空格或为空
+func TestKafkaMessage(t *testing.T) {
+	keys := []string{"UVPN 权限-1", "", "王 二小"}
+	msg := (&Message{
+		Topic: "UVPN",
+		Tag:   "UVPN",
+		Keys:  keys,
+		Body:  []byte(`{"version":1}`),
+	}).WithProperty("DLQ_REASON", "查无此人")
+
+	km, msgId, err := toKafkaMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgId == "" || string(km.Key) != keys[0] || km.Topic != "UVPN" {
+		t.Errorf("toKafkaMessage() = %+v, %q", km, msgId)
+	}
+
+	km.Partition, km.Offset, km.Time = 2, 42, time.Unix(1700000000, 0)
+	got := fromKafkaMessage(km)
+	want := &Message{
+		Id:         msgId,
+		Topic:      "UVPN",
+		Tag:        "UVPN",
+		Keys:       keys,
+		Body:       []byte(`{"version":1}`),
+		Properties: map[string]string{"DLQ_REASON": "查无此人"},
+		StoredAt:   km.Time,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fromKafkaMessage() = %+v, want %+v", got, want)
+	}
+
+	// 以空格分隔 keys 的旧消息头
+	legacy := kafka.Message{Headers: []kafka.Header{{Key: headerKeys, Value: []byte("SP-1 1001")}}}
+	if got := fromKafkaMessage(legacy); !reflect.DeepEqual(got.Keys, []string{"SP-1", "1001"}) {
+		t.Errorf("legacy keys = %q", got.Keys)
+	}
+
+	// 其他生产者发送的消息没有消息头
+	if got := fromKafkaMessage(kafka.Message{Topic: "UVPN", Partition: 1, Offset: 7}); got.Id != "UVPN-1@7" || got.Tag != "" {
+		t.Errorf("fromKafkaMessage() without headers = %+v", got)
+	}
+}
+
+func TestNewKafka(t *testing.T) {
+	if _, err := NewKafka(&KafkaConfig{}); err == nil {
+		t.Error("NewKafka without brokers should fail")
+	}
+	k, err := NewKafka(&KafkaConfig{Brokers: []string{"127.0.0.1:9092"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.cfg.RetryDelay != DefaultKafkaRetryDelay {
+		t.Errorf("RetryDelay = %v", k.cfg.RetryDelay)
+	}
+	if err = k.Subscribe("UVPN", "UVPN", nil); err == nil {
+		t.Error("Subscribe without group should fail")
+	}
+}
+
+// fakeKafkaReader 按顺序返回消息与错误 记录提交的位点
+type fakeKafkaReader struct {
+	mu        sync.Mutex
+	fetches   []interface{} // kafka.Message 或 error
+	committed []int64
+}
+
+func (r *fakeKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if len(r.fetches) > 0 {
+		next := r.fetches[0]
+		r.fetches = r.fetches[1:]
+		r.mu.Unlock()
+		if err, ok := next.(error); ok {
+			return kafka.Message{}, err
+		}
+		return next.(kafka.Message), nil
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeKafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *fakeKafkaReader) Close() error { return nil }
+
+func (r *fakeKafkaReader) Committed() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64(nil), r.committed...)
+}
+
+// 拉取失败后重试 处理返回 Retry 时不提交位点 确认后才提交
+func TestKafkaConsume(t *testing.T) {
+	reader := &fakeKafkaReader{fetches: []interface{}{
+		errors.New("broker unavailable"),
+		kafka.Message{Topic: "UVPN", Offset: 1},
+		kafka.Message{Topic: "UVPN", Offset: 2},
+	}}
+	k, err := NewKafka(&KafkaConfig{Brokers: []string{"127.0.0.1:9092"}, GroupID: "uvpn", RetryDelay: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts int32
+	retrying := make(chan struct{})
+	release := make(chan struct{})
+	k.subs = append(k.subs, &kafkaSub{reader: reader, handler: func(ctx context.Context, msg *Message) Action {
+		if msg.Id != "UVPN-0@1" {
+			return Ack
+		}
+		// 第一条消息重试两次 第二次重试前等待检查位点
+		switch atomic.AddInt32(&attempts, 1) {
+		case 2:
+			close(retrying)
+			<-release
+		case 3:
+			return Ack
+		}
+		return Retry
+	}})
+	if err = k.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer k.Shutdown()
+
+	select {
+	case <-retrying:
+	case <-time.After(5 * time.Second):
+		t.Fatal("拉取失败后应继续消费")
+	}
+	if got := reader.Committed(); len(got) != 0 {
+		t.Errorf("重试中的消息不应提交位点: %v", got)
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(reader.Committed()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := reader.Committed(); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("committed = %v, want [1 2]", got)
+	}
+}
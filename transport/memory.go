@@ -0,0 +1,205 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultMemoryRetryDelay 内存传输默认重投延时
+const DefaultMemoryRetryDelay = 100 * time.Millisecond
+
+// ErrClosed 传输已关闭
+var ErrClosed = errors.New("transport closed")
+
+// Memory 进程内消息传输 用于测试与本地开发
+// 每个主题一个队列 已订阅的主题由后台协程逐条投递 未订阅的主题只保留发布记录
+type Memory struct {
+	RetryDelay time.Duration // 返回 Retry 后重投的延时
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	seq       int64
+	started   bool
+	closed    bool
+	subs      map[string]*memorySub
+	queues    map[string][]*Message
+	published map[string][]*Message
+	inflight  int // 已出队未确认或等待重投的消息数
+	wg        sync.WaitGroup
+}
+
+type memorySub struct {
+	tag     string
+	handler Handler
+}
+
+// NewMemory 新建内存传输
+func NewMemory() *Memory {
+	m := &Memory{
+		RetryDelay: DefaultMemoryRetryDelay,
+		subs:       map[string]*memorySub{},
+		queues:     map[string][]*Message{},
+		published:  map[string][]*Message{},
+	}
+	m.cond = sync.NewCond(&m.mu)
+	return m
+}
+
+// Subscribe 订阅主题 每个主题只能有一个订阅
+func (m *Memory) Subscribe(topic, tag string, h Handler) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started {
+		return errors.New("subscribe after start")
+	}
+	if _, ok := m.subs[topic]; ok {
+		return errors.New("topic already subscribed: " + topic)
+	}
+	m.subs[topic] = &memorySub{tag: tag, handler: h}
+	return nil
+}
+
+// Publish 发布消息 消息在 Start 之前发布也会在启动后投递
+func (m *Memory) Publish(ctx context.Context, msg *Message) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return "", ErrClosed
+	}
+	m.seq++
+	stored := *msg
+	stored.Id = strconv.FormatInt(m.seq, 10)
+	stored.StoredAt = time.Now()
+	stored.Attempts = 0
+	if msg.Properties != nil {
+		stored.Properties = map[string]string{}
+		for key, value := range msg.Properties {
+			stored.Properties[key] = value
+		}
+	}
+	m.published[msg.Topic] = append(m.published[msg.Topic], &stored)
+	if _, ok := m.subs[msg.Topic]; ok {
+		m.queues[msg.Topic] = append(m.queues[msg.Topic], &stored)
+		m.cond.Broadcast()
+	}
+	return stored.Id, nil
+}
+
+// Published 返回发布到主题的全部消息 按发布顺序
+func (m *Memory) Published(topic string) []*Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Message(nil), m.published[topic]...)
+}
+
+// Start 为每个订阅启动投递协程
+func (m *Memory) Start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if m.started {
+		return nil
+	}
+	m.started = true
+	for topic, sub := range m.subs {
+		m.wg.Add(1)
+		go m.deliver(topic, sub)
+	}
+	return nil
+}
+
+// deliver 逐条投递主题中的消息
+func (m *Memory) deliver(topic string, sub *memorySub) {
+	defer m.wg.Done()
+	for {
+		m.mu.Lock()
+		for len(m.queues[topic]) == 0 && !m.closed {
+			m.cond.Wait()
+		}
+		if m.closed {
+			m.mu.Unlock()
+			return
+		}
+		msg := m.queues[topic][0]
+		m.queues[topic] = m.queues[topic][1:]
+		m.inflight++
+		m.mu.Unlock()
+
+		if sub.tag != "" && sub.tag != "*" && msg.Tag != sub.tag {
+			m.done()
+			continue
+		}
+		if sub.handler(context.Background(), msg) == Ack {
+			m.done()
+			continue
+		}
+		retry := *msg
+		retry.Attempts++
+		time.AfterFunc(m.RetryDelay, func() {
+			m.mu.Lock()
+			if !m.closed {
+				m.queues[topic] = append(m.queues[topic], &retry)
+			}
+			m.inflight--
+			m.cond.Broadcast()
+			m.mu.Unlock()
+		})
+	}
+}
+
+// done 消息处理完毕
+func (m *Memory) done() {
+	m.mu.Lock()
+	m.inflight--
+	m.cond.Broadcast()
+	m.mu.Unlock()
+}
+
+// Drain 等待所有已订阅主题的消息处理完毕(包括重投) 超时返回 false
+func (m *Memory) Drain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	timer := time.AfterFunc(timeout, func() {
+		m.mu.Lock()
+		m.cond.Broadcast()
+		m.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for !m.idle() {
+		if m.closed || !time.Now().Before(deadline) {
+			return false
+		}
+		m.cond.Wait()
+	}
+	return true
+}
+
+// idle 没有待投递与处理中的消息
+func (m *Memory) idle() bool {
+	if m.inflight > 0 {
+		return false
+	}
+	for _, q := range m.queues {
+		if len(q) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Shutdown 停止投递 未投递的消息丢弃
+func (m *Memory) Shutdown() error {
+	m.mu.Lock()
+	m.closed = true
+	m.cond.Broadcast()
+	m.mu.Unlock()
+	m.wg.Wait()
+	return nil
+}
@@ -0,0 +1,85 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 订阅、按tag过滤、重试与发布记录
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	m.RetryDelay = time.Millisecond
+
+	var mu sync.Mutex
+	var got []string
+	attempts := map[string]int32{}
+	err := m.Subscribe("orders", "orders", func(ctx context.Context, msg *Message) Action {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[string(msg.Body)] = msg.Attempts
+		// 第一条消息失败两次后成功
+		if string(msg.Body) == "a" && msg.Attempts < 2 {
+			return Retry
+		}
+		got = append(got, string(msg.Body))
+		return Ack
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Subscribe("orders", "", nil); err == nil {
+		t.Error("duplicate subscribe should fail")
+	}
+
+	// 启动前发布的消息也会投递
+	for _, msg := range []*Message{
+		{Topic: "orders", Tag: "orders", Body: []byte("a")},
+		{Topic: "orders", Tag: "other", Body: []byte("filtered")},
+		{Topic: "replies", Tag: "replies", Body: []byte("r")},
+	} {
+		if _, err = m.Publish(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Subscribe("late", "", nil); err == nil {
+		t.Error("subscribe after start should fail")
+	}
+	if _, err = m.Publish(context.Background(), (&Message{Topic: "orders", Tag: "orders", Body: []byte("b")}).WithProperty("k", "v")); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Drain(time.Second) {
+		t.Fatal("Drain timeout")
+	}
+
+	mu.Lock()
+	if len(got) != 2 || got[0] != "b" || got[1] != "a" {
+		t.Errorf("delivered %v, want [b a]", got)
+	}
+	if attempts["a"] != 2 || attempts["b"] != 0 {
+		t.Errorf("attempts = %v", attempts)
+	}
+	if _, ok := attempts["filtered"]; ok {
+		t.Error("message with other tag should be filtered")
+	}
+	mu.Unlock()
+
+	orders := m.Published("orders")
+	if len(orders) != 3 || orders[0].Id == "" || orders[0].Id == orders[2].Id || orders[2].Property("k") != "v" {
+		t.Errorf("Published(orders) = %v", orders)
+	}
+	if replies := m.Published("replies"); len(replies) != 1 || string(replies[0].Body) != "r" {
+		t.Errorf("Published(replies) = %v", replies)
+	}
+
+	if err = m.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Publish(context.Background(), &Message{Topic: "orders"}); err != ErrClosed {
+		t.Errorf("Publish after shutdown err = %v", err)
+	}
+}
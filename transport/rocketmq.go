@@ -0,0 +1,133 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/apache/rocketmq-client-go/v2/producer"
+	"time"
+)
+
+// PropertyDelayLevel 延时级别属性 仅 RocketMQ 支持 共有18个级别 1s 5s 10s 30s 1m 2m 3m 4m 5m 6m 7m 8m 9m 10m 20m 30m 1h 2h
+const PropertyDelayLevel = primitive.PropertyDelayTimeLevel
+
+// RocketMQConfig RocketMQ 传输配置
+type RocketMQConfig struct {
+	NameSrvAddrs      []string // 名称服务地址 ip:port
+	GroupName         string   // 消费组
+	MaxReconsumeTimes int32    // broker 最大重投次数 超过后进入 broker 的死信队列
+	ConsumeFromFirst  bool     // 新消费组从最早的消息开始消费
+	Retry             int      // 发送失败重试次数
+}
+
+// RocketMQ 基于 RocketMQ 的消息传输
+type RocketMQ struct {
+	cfg      RocketMQConfig
+	producer rocketmq.Producer
+	consumer rocketmq.PushConsumer // 有订阅时才创建
+}
+
+// NewRocketMQ 新建 RocketMQ 传输
+func NewRocketMQ(c *RocketMQConfig) (*RocketMQ, error) {
+	p, err := rocketmq.NewProducer(
+		producer.WithNsResolver(primitive.NewPassthroughResolver(c.NameSrvAddrs)),
+		producer.WithRetry(c.Retry),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &RocketMQ{cfg: *c, producer: p}, nil
+}
+
+// Subscribe 订阅主题 每条消息单独处理 返回 Retry 时由 broker 稍后重投
+func (r *RocketMQ) Subscribe(topic, tag string, h Handler) (err error) {
+	if r.consumer == nil {
+		opts := []consumer.Option{
+			consumer.WithGroupName(r.cfg.GroupName),
+			consumer.WithNsResolver(primitive.NewPassthroughResolver(r.cfg.NameSrvAddrs)),
+			consumer.WithConsumeMessageBatchMaxSize(1),
+		}
+		if r.cfg.MaxReconsumeTimes > 0 {
+			opts = append(opts, consumer.WithMaxReconsumeTimes(r.cfg.MaxReconsumeTimes))
+		}
+		if r.cfg.ConsumeFromFirst {
+			opts = append(opts, consumer.WithConsumeFromWhere(consumer.ConsumeFromFirstOffset))
+		}
+		if r.consumer, err = rocketmq.NewPushConsumer(opts...); err != nil {
+			return
+		}
+	}
+
+	if tag == "" {
+		tag = "*"
+	}
+	selector := consumer.MessageSelector{Type: consumer.TAG, Expression: tag}
+	return r.consumer.Subscribe(topic, selector, func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		for _, msg := range msgs {
+			if h(ctx, fromMessageExt(msg)) == Retry {
+				return consumer.ConsumeRetryLater, nil
+			}
+		}
+		return consumer.ConsumeSuccess, nil
+	})
+}
+
+// Publish 同步发布消息
+func (r *RocketMQ) Publish(ctx context.Context, msg *Message) (string, error) {
+	m := primitive.NewMessage(msg.Topic, msg.Body)
+	if msg.Tag != "" {
+		m.WithTag(msg.Tag)
+	}
+	if len(msg.Keys) > 0 {
+		m.WithKeys(msg.Keys)
+	}
+	for key, value := range msg.Properties {
+		m.WithProperty(key, value)
+	}
+	res, err := r.producer.SendSync(ctx, m)
+	if err != nil {
+		return "", err
+	}
+	if res.Status != primitive.SendOK {
+		return res.MsgID, errors.New("send message status: " + res.String())
+	}
+	return res.MsgID, nil
+}
+
+// Start 启动生产者 有订阅时启动消费者
+func (r *RocketMQ) Start() (err error) {
+	if err = r.producer.Start(); err != nil {
+		return
+	}
+	if r.consumer != nil {
+		err = r.consumer.Start()
+	}
+	return
+}
+
+// Shutdown 关闭消费者与生产者
+func (r *RocketMQ) Shutdown() (err error) {
+	if r.consumer != nil {
+		err = r.consumer.Shutdown()
+	}
+	if perr := r.producer.Shutdown(); err == nil {
+		err = perr
+	}
+	return
+}
+
+// fromMessageExt 转换为传输层消息
+func fromMessageExt(msg *primitive.MessageExt) *Message {
+	return &Message{
+		Id:         msg.MsgId,
+		Topic:      msg.Topic,
+		Tag:        msg.GetTags(),
+		Keys:       []string{msg.GetKeys()},
+		Body:       msg.Body,
+		Properties: msg.GetProperties(),
+		Attempts:   msg.ReconsumeTimes,
+		StoredAt:   time.Unix(0, msg.StoreTimestamp*int64(time.Millisecond)),
+	}
+}
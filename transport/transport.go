@@ -0,0 +1,60 @@
+/*
+消息传输层：
+消费者与生产者通过 Transport 接口订阅、确认、重试与发布消息，不直接依赖具体的消息队列;
+RocketMQ、Kafka 为生产环境实现，Memory 为测试与本地开发使用的进程内实现;
+*/
+package transport
+
+import (
+	"context"
+	"time"
+)
+
+// Message 传输层消息
+type Message struct {
+	Id         string
+	Topic      string
+	Tag        string
+	Keys       []string
+	Body       []byte
+	Properties map[string]string
+	Attempts   int32     // 已重试次数 首次投递为0
+	StoredAt   time.Time // 消息存储时间
+}
+
+// Property 取消息属性
+func (m *Message) Property(key string) string {
+	return m.Properties[key]
+}
+
+// WithProperty 设置消息属性
+func (m *Message) WithProperty(key, value string) *Message {
+	if m.Properties == nil {
+		m.Properties = map[string]string{}
+	}
+	m.Properties[key] = value
+	return m
+}
+
+// Action 处理消息后的动作
+type Action int
+
+const (
+	Ack   Action = iota // 确认消息 不再投递
+	Retry               // 稍后重新投递 Attempts 加1
+)
+
+// Handler 消息处理函数
+type Handler func(ctx context.Context, msg *Message) Action
+
+// Transport 消息传输
+type Transport interface {
+	// Subscribe 订阅主题 tag 为空或 * 时不过滤 需在 Start 之前调用
+	Subscribe(topic, tag string, h Handler) error
+	// Publish 发布消息 返回消息Id
+	Publish(ctx context.Context, msg *Message) (string, error)
+	// Start 开始收发消息
+	Start() error
+	// Shutdown 停止收发消息
+	Shutdown() error
+}
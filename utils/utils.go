@@ -3,16 +3,13 @@ package utils
 import (
 	"bufio"
 	"encoding/json"
-	"errors"
 	"fmt"
-	log "github.com/sirupsen/logrus"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"strings"
-	"syscall"
 )
 
 // GetAllFile 获取目录下所有文件
@@ -53,97 +50,12 @@ func ReadFile(path string) {
 	}
 }
 
-// ExtractViPFromCCD 从ccd文件提取出用户的VIP
-func ExtractViPFromCCD(path string) (vip string, err error) {
-	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0666)
-	if err != nil {
-		fmt.Println("文件打开失败", err)
-	}
-	//及时关闭file句柄
-	defer file.Close()
-	//读原来文件的内容，并且显示在终端
-	reader := bufio.NewReader(file)
-	line := 0
-	for {
-		str, err := reader.ReadString('\n')
-		line++
-		if strings.Contains(str, "ifconfig-push") {
-			if str == "" {
-				return "", errors.New("________ipconfpush语句错误______")
-			}
-			// VIP所在行用空格分割后提取
-			strSplit := strings.Split(str, " ")
-			res := strings.Replace(strSplit[1], " ", "", -1)
-			return res, nil
-		}
-		if err == io.EOF {
-			return "", errors.New("未找到VIP")
-		}
-	}
-	return
-}
-
 // IsFileExist 判断文件是否存在
 func IsFileExist(path string) bool {
 	_, err := os.Lstat(path)
 	return !os.IsNotExist(err)
 }
 
-// AddRoute4User 向文件写入内容
-func AddRoute4User(path string, content string) (err error) {
-	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0666)
-	if err != nil {
-		fmt.Println("文件打开失败", err)
-	}
-	//及时关闭file句柄
-	defer file.Close()
-
-	// 阻塞模式下，加排他锁
-	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
-		log.Info("add exclusive lock in block failed", err)
-	}
-	// 这里进行业务逻辑
-	//写入文件时，使用带缓存的 *Writer
-	write := bufio.NewWriter(file)
-	write.WriteString("\n" + content + "\n")
-
-	//Flush将缓存的文件真正写入到文件中
-	write.Flush()
-
-	// 解锁
-	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_UN); err != nil {
-		log.Info("unlock exclusive lock failed", err)
-	}
-	return
-}
-
-func GenerateCCD(path string, content string) (err error) {
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
-	if err != nil {
-		fmt.Println("文件打开失败", err)
-	}
-	//及时关闭file句柄
-	defer file.Close()
-
-	// 阻塞模式下，加排他锁
-	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
-		log.Info("add exclusive lock in block failed", err)
-	}
-	// 这里进行业务逻辑
-	//写入文件时，使用带缓存的 *Writer
-	write := bufio.NewWriter(file)
-	write.WriteString("\n" + content + "\n")
-
-	//Flush将缓存的文件真正写入到文件中
-	write.Flush()
-
-	// 解锁
-	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_UN); err != nil {
-		log.Info("unlock exclusive lock failed", err)
-	}
-	return
-}
-
 // IsInSlice 判断是否已在切片中
 func IsInSlice(ele interface{}, s []interface{}) bool {
 	for _, item := range s {
@@ -160,7 +72,7 @@ func IsInSlice(ele interface{}, s []interface{}) bool {
 
 type IPInfo struct {
 	Code int `json:"code"`
-	Data IP  `json:"data`
+	Data IP  `json:"data"`
 }
 
 type IP struct {
@@ -204,9 +116,9 @@ func Ipv4MaskString(m []byte) string {
 	return fmt.Sprintf("%d.%d.%d.%d", m[0], m[1], m[2], m[3])
 }
 
-// ResolveIP 将域名解析成IP
+// ResolveIP 将域名解析成IPv4地址
 func ResolveIP(domain string) (ip string, err error) {
-	addr, err := net.ResolveIPAddr("ip", domain)
+	addr, err := net.ResolveIPAddr("ip4", domain)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,37 @@
+package uuap
+
+import (
+	"github.com/go-ldap/ldap/v3"
+	"strconv"
+	"time"
+)
+
+const (
+	// UACAccountDisable userAccountControl 中的 ACCOUNTDISABLE 标志位
+	UACAccountDisable = 0x2
+	// accountNeverExpires accountExpires 为0或该值时表示永不过期
+	accountNeverExpires = 0x7FFFFFFFFFFFFFFF
+	// fileTimeEpochOffset 1601-01-01 到 1970-01-01 的秒数 accountExpires 为自1601年起的100纳秒数
+	fileTimeEpochOffset = 11644473600
+)
+
+// AccountDisabled AD账户是否已禁用
+func AccountDisabled(entry *ldap.Entry) bool {
+	uac, err := strconv.ParseInt(entry.GetAttributeValue("userAccountControl"), 10, 64)
+	return err == nil && uac&UACAccountDisable != 0
+}
+
+// AccountExpires AD账户的过期时间 永不过期时返回零值
+func AccountExpires(entry *ldap.Entry) time.Time {
+	v, err := strconv.ParseInt(entry.GetAttributeValue("accountExpires"), 10, 64)
+	if err != nil || v <= 0 || v == accountNeverExpires {
+		return time.Time{}
+	}
+	return time.Unix(v/1e7-fileTimeEpochOffset, v%1e7*100)
+}
+
+// AccountExpired AD账户在 now 时是否已过期
+func AccountExpired(entry *ldap.Entry, now time.Time) bool {
+	expires := AccountExpires(entry)
+	return !expires.IsZero() && !expires.After(now)
+}
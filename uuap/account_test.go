@@ -0,0 +1,42 @@
+package uuap
+
+import (
+	"github.com/go-ldap/ldap/v3"
+	"testing"
+	"time"
+)
+
+func newEntry(uac, expires string) *ldap.Entry {
+	return ldap.NewEntry("CN=王二小,DC=x,DC=com", map[string][]string{
+		"userAccountControl": {uac},
+		"accountExpires":     {expires},
+	})
+}
+
+func TestAccountDisabled(t *testing.T) {
+	for uac, want := range map[string]bool{"512": false, "514": true, "66050": true, "66048": false, "": false} {
+		if got := AccountDisabled(newEntry(uac, "0")); got != want {
+			t.Errorf("AccountDisabled(%q) = %v", uac, got)
+		}
+	}
+}
+
+func TestAccountExpires(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 2021-12-31 16:00:00 UTC
+	expired := newEntry("512", "132854400000000000")
+	if got := AccountExpires(expired); !got.Equal(time.Date(2021, 12, 31, 16, 0, 0, 0, time.UTC)) {
+		t.Errorf("AccountExpires() = %v", got)
+	}
+	if !AccountExpired(expired, now) {
+		t.Error("account should be expired")
+	}
+	if AccountExpired(expired, now.AddDate(0, 0, -1)) {
+		t.Error("account should not be expired yet")
+	}
+	for _, never := range []string{"0", "9223372036854775807", ""} {
+		if entry := newEntry("512", never); !AccountExpires(entry).IsZero() || AccountExpired(entry, now) {
+			t.Errorf("accountExpires %q should never expire", never)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/go-ldap/ldap/v3"
 	"github.com/pkg/errors"
 	"mq/cache"
+	"mq/mgmt"
+	"mq/ovpn"
 	"time"
 )
 
@@ -45,13 +47,49 @@ type Config struct {
 		CCDFilePath    string
 		DevCCDFilePath string // 开发时的ccd地址
 		Dev            bool   // 是否是开发模式
+		QuarantineDir  string // 默认实例的隔离目录 默认为 ccd目录.quarantine
+		StatusFile     string // 默认实例的 OpenVPN 状态文件
+		// 过期权限扫描间隔 默认1分钟
+		ExpireSweepInterval time.Duration
+		// 按AD账户状态禁用/启用用户的间隔 默认10分钟 为负数时不同步
+		DisableSyncInterval time.Duration
 	}
-	Redis    cache.Config
-	LdapCfg  LdapConn
+	Redis      cache.Config
+	VipPool    ovpn.PoolConfig
+	Management mgmt.Config           // 默认实例的 OpenVPN 管理接口
+	Instances  []ovpn.InstanceConfig // OpenVPN 实例列表 为空时由 System、VipPool 与 Management 构建默认实例
+	LdapCfg    LdapConn
+	Transport  string // 消息传输 rocketmq(默认) kafka memory(本地开发 工单从标准输入读取)
+	// 工单、死信与回复主题名在 RocketMQ 中配置 Kafka 共用
 	RocketMQ struct {
-		Addr      string
-		Port      string
-		TopicName string
+		Addr       string
+		Port       string
+		TopicName  string
+		DLQTopic   string // 死信主题 默认为 TopicName_DLQ
+		MaxRetries int32  // 暂时失败(LDAP、redis 不可用等)的最大重试次数 默认3
+		ReplyTopic string // 工单处理结果的回复主题 为空时不回复
+	}
+	Admin struct {
+		Addr  string // 管理接口监听地址 如 127.0.0.1:8080 为空时不启动
+		Token string // 管理接口的 Bearer Token 为空时不校验
+	}
+	// 权限变更审计记录
+	Audit struct {
+		Driver string // file(默认) redis 或 none
+		Path   string // file: JSONL 文件路径 相对路径以配置文件所在目录为准 默认为该目录下的 uvpn-audit.jsonl
+		Key    string // redis: stream 键 默认 OVPNAUDIT
+	}
+	// 按用户已授权的路由生成 nftables 规则
+	Firewall struct {
+		Enabled  bool
+		Table    string        // nftables 表名 默认 uvpn
+		Nft      string        // nft 命令 默认 nft
+		DryRun   bool          // 只将规则集写入日志 不应用
+		Interval time.Duration // 定时全量同步的间隔 默认5分钟
+	}
+	Kafka struct {
+		Brokers    []string      // broker 地址 ip:port
+		RetryDelay time.Duration // 暂时失败后的重试间隔 默认5秒
 	}
 }
 
@@ -108,7 +146,7 @@ func Init(c *Config) (err error) {
 		func(s string) (ldap.Client, error) {
 			conn, err := ldap.DialURL(LdapConns.ConnUrl)
 			if err != nil {
-				fmt.Print("Fail to dial ldap url, err: ", err)
+				return nil, errors.Wrap(err, "Fail to dial ldap url")
 			}
 
 			// 重新连接TLS
@@ -142,7 +180,7 @@ func FetchUser(ctx *LdapConn, user *LdapAttributes) (result *ldap.Entry, err err
 	}
 	defer LdapConn.Close()
 
-	ldapFilterCn := "(cn=" + user.DisplayName + user.Num + ")"
+	ldapFilterCn := "(cn=" + ldap.EscapeFilter(user.DisplayName+user.Num) + ")"
 	searchFilter := "(objectClass=organizationalPerson)"
 	if user.DisplayName != "" && user.Num != "" {
 		searchFilter += ldapFilterCn
@@ -170,12 +208,14 @@ func FetchUser(ctx *LdapConn, user *LdapAttributes) (result *ldap.Entry, err err
 	return
 }
 
-func FetchLdapUsers(user *LdapAttributes) (result []*ldap.Entry) {
+// FetchLdapUsers 按条件查询有邮箱的ldap用户 查询失败时返回错误
+func FetchLdapUsers(user *LdapAttributes) (result []*ldap.Entry, err error) {
 	// 获取连接
 	LdapConn, err := LdapPool.Get()
 	if err != nil {
-		fmt.Printf(err.Error())
+		return nil, errors.Wrap(err, ErrGetLdapConn)
 	}
+	defer LdapConn.Close()
 
 	// 多查询条件
 	ldapFilterNum := "(employeeNumber=" + user.Num + ")"
@@ -217,7 +257,7 @@ func FetchLdapUsers(user *LdapAttributes) (result []*ldap.Entry) {
 
 	searchRequest := ldap.NewSearchRequest(
 		LdapConns.BaseDn,
-		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 500, 0, false,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
 		searchFilter,
 		Attrs,
 		nil,
@@ -225,7 +265,7 @@ func FetchLdapUsers(user *LdapAttributes) (result []*ldap.Entry) {
 
 	sr, err := LdapConn.SearchWithPaging(searchRequest, 100)
 	if err != nil {
-		fmt.Printf("Fail to search users, err: " + err.Error())
+		return nil, errors.Wrap(err, "Fail to search users")
 	}
 	if len(sr.Entries) > 0 && len(sr.Entries[0].Attributes) > 0 {
 		result = sr.Entries